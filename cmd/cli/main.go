@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -25,24 +26,55 @@ func main() {
 
 	reader := bufio.NewReader(os.Stdin)
 
+	// Requête en cours de saisie, sur une ou plusieurs lignes
+	var query string
+
 	for {
-		fmt.Print("> ")
-		line, _ := reader.ReadString('\n')
+		if query == "" {
+			fmt.Print("> ")
+		} else {
+			fmt.Print("... ")
+		}
+		line, readErr := reader.ReadString('\n')
 		line = strings.TrimSpace(line)
 		if line == "" {
-			continue
+			// Fin de l'entrée standard : on quitte proprement
+			if readErr != nil && query == "" {
+				break
+			}
+			if readErr == nil {
+				continue
+			}
 		}
 
 		// Commandes internes (hors SQL)
-		if line == ".exit" || strings.EqualFold(line, "exit") {
+		if query == "" && (line == ".exit" || strings.EqualFold(line, "exit")) {
 			fmt.Println("bye 👋")
 			break
 		}
 
+		// Une requête sur plusieurs lignes se termine par ';'
+		if query != "" {
+			query += "\n" + line
+			if !strings.HasSuffix(line, ";") && readErr == nil {
+				continue
+			}
+		} else {
+			query = line
+		}
+
 		// Analyse de la requête SQL
-		stmt, err := intsql.Parse(line)
+		stmt, err := intsql.Parse(query)
+		if errors.Is(err, intsql.ErrIncomplete) && !strings.HasSuffix(line, ";") && readErr == nil {
+			// Requête incomplète : on lit la ligne suivante
+			continue
+		}
+		query = ""
 		if err != nil {
 			fmt.Println("❌ Erreur de parsing:", err)
+			if readErr != nil {
+				break
+			}
 			continue
 		}
 
@@ -52,4 +84,9 @@ func main() {
 			continue
 		}
 	}
+
+	// Écrit les pages modifiées et ferme les fichiers des tables
+	if err := database.Close(); err != nil {
+		fmt.Println("❌ Erreur de fermeture:", err)
+	}
 }
@@ -1,106 +1,579 @@
 package db
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 	"sync"
 )
 
-type Entry struct {
-	Key   string
-	Value map[string]string
+// pageID identifie un nœud de l’arbre. 0 signifie « aucun nœud ».
+type pageID uint32
+
+// node est un nœud (page) du B+ Tree.
+// Les nœuds internes ne contiennent que des clés de routage et les
+// identifiants de leurs enfants ; les feuilles contiennent les couples
+// (clé, valeur) et sont chaînées entre elles dans l’ordre des clés.
+type node struct {
+	id       pageID
+	leaf     bool
+	keys     []string
+	children []pageID // nœuds internes : len(keys)+1 enfants
+	values   []Row    // feuilles : une valeur par clé
+	next     pageID   // feuilles : feuille suivante
+	pages    []pageID // pages occupées sur disque (pages[0] == id)
 }
 
-// BPTree est une version simplifiée d’un B+ Tree logique.
+// BPTree est un B+ Tree d’ordre `order` : un nœud interne possède au plus
+// `order` enfants et une feuille au plus `order-1` clés. Tous les nœuds
+// hors racine contiennent au moins (order-1)/2 clés. Les clés sont rangées
+// selon la fonction cmp (voir keyOrder).
+//
+// Sans pager, l’arbre vit entièrement en mémoire. Avec un pager, chaque
+// nœud occupe une chaîne de pages du fichier : les nœuds sont chargés à la
+// demande, les nœuds modifiés sont marqués sales et seuls ceux-ci sont
+// réécrits par Flush.
 type BPTree struct {
-	order int     // ordre logique
-	data  []Entry // liste triée de (clé, valeur)
-	mu    sync.RWMutex
+	order  int
+	cmp    func(a, b string) int
+	root   pageID
+	size   int
+	nextID pageID
+	pager  *pager
+	mu     sync.RWMutex
+
+	cacheMu sync.Mutex // protège nodes, dirty et err lors des lectures
+	nodes   map[pageID]*node
+	dirty   map[pageID]bool
+	err     error
 }
 
+// cacheLimit est le nombre de nœuds au-delà duquel Flush vide le cache.
+const cacheLimit = 4096
+
+// treeError transporte une erreur d’E/S survenue au milieu d’une opération.
+type treeError struct{ err error }
+
 func NewBPTree(order int) *BPTree {
+	b := newTree(nil, order, strings.Compare)
+	b.root = b.alloc(true).id
+	return b
+}
+
+// newPagedBPTree crée un arbre vide dans un fichier paginé.
+func newPagedBPTree(p *pager, order int, cmp func(a, b string) int) (*BPTree, error) {
+	b := newTree(p, order, cmp)
+	if err := b.guard(func() { b.root = b.alloc(true).id }); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// openBPTree ouvre l’arbre décrit par l’en-tête du fichier paginé.
+func openBPTree(p *pager, cmp func(a, b string) int) *BPTree {
+	b := newTree(p, int(p.hdr.Order), cmp)
+	b.root = pageID(p.hdr.Root)
+	b.size = int(p.hdr.Size)
+	return b
+}
+
+func newTree(p *pager, order int, cmp func(a, b string) int) *BPTree {
+	if order < 3 {
+		order = 3
+	}
 	return &BPTree{
 		order: order,
-		data:  make([]Entry, 0),
+		cmp:   cmp,
+		pager: p,
+		nodes: make(map[pageID]*node),
+		dirty: make(map[pageID]bool),
+	}
+}
+
+func (b *BPTree) alloc(leaf bool) *node {
+	var id pageID
+	if b.pager != nil {
+		var err error
+		if id, err = b.pager.allocate(); err != nil {
+			panic(treeError{err})
+		}
+	} else {
+		b.nextID++
+		id = b.nextID
+	}
+
+	n := &node{id: id, leaf: leaf, pages: []pageID{id}}
+	b.nodes[id] = n
+	b.dirty[id] = true
+	return n
+}
+
+func (b *BPTree) free(id pageID) {
+	if b.pager != nil {
+		for _, p := range b.node(id).pages {
+			b.pager.release(p)
+		}
+	}
+	delete(b.nodes, id)
+	delete(b.dirty, id)
+}
+
+// node renvoie un nœud, en le chargeant depuis le disque si nécessaire.
+func (b *BPTree) node(id pageID) *node {
+	if id == 0 {
+		return nil
 	}
+
+	b.cacheMu.Lock()
+	defer b.cacheMu.Unlock()
+
+	if n, ok := b.nodes[id]; ok {
+		return n
+	}
+	if b.pager == nil {
+		return nil
+	}
+
+	data, pages, err := b.pager.readChain(id)
+	if err != nil {
+		panic(treeError{err})
+	}
+	n, err := decodeNode(id, data, b.pager.hdr.Format)
+	if err != nil {
+		panic(treeError{fmt.Errorf("page %d: %w", id, err)})
+	}
+	n.pages = pages
+	b.nodes[id] = n
+	return n
+}
+
+// touch marque un nœud comme modifié.
+func (b *BPTree) touch(nodes ...*node) {
+	for _, n := range nodes {
+		b.dirty[n.id] = true
+	}
+}
+
+// guard exécute fn en transformant une erreur d’E/S en erreur persistante :
+// l’arbre n’est plus fiable et Flush la renverra.
+func (b *BPTree) guard(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			te, ok := r.(treeError)
+			if !ok {
+				panic(r)
+			}
+			b.cacheMu.Lock()
+			if b.err == nil {
+				b.err = te.err
+			}
+			b.cacheMu.Unlock()
+			err = te.err
+		}
+	}()
+	fn()
+	return nil
+}
+
+// Err renvoie la première erreur d’E/S rencontrée par l’arbre.
+func (b *BPTree) Err() error {
+	b.cacheMu.Lock()
+	defer b.cacheMu.Unlock()
+	return b.err
+}
+
+func (b *BPTree) maxKeys() int { return b.order - 1 }
+func (b *BPTree) minKeys() int { return (b.order - 1) / 2 }
+
+// childIndex renvoie l’indice de l’enfant d’un nœud interne
+// susceptible de contenir la clé.
+func (b *BPTree) childIndex(n *node, key string) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return b.cmp(n.keys[i], key) > 0
+	})
 }
 
-func (b *BPTree) Insert(key string, value map[string]string) {
+// search renvoie la position de la clé dans une feuille, ou celle où
+// l’insérer.
+func (b *BPTree) search(n *node, key string) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return b.cmp(n.keys[i], key) >= 0
+	})
+}
+
+// Insert ajoute ou remplace la valeur associée à une clé.
+func (b *BPTree) Insert(key string, value Row) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Si la clé existe déjà, mise à jour
-	for i, e := range b.data {
-		if e.Key == key {
-			b.data[i].Value = value
+	b.guard(func() {
+		sep, right, split := b.insert(b.root, key, value)
+		if !split {
 			return
 		}
-	}
 
-	// Sinon, on insère et on trie
-	b.data = append(b.data, Entry{Key: key, Value: value})
-	sort.Slice(b.data, func(i, j int) bool {
-		return b.data[i].Key < b.data[j].Key
+		// La racine a éclaté : l’arbre gagne un niveau.
+		root := b.alloc(false)
+		root.keys = []string{sep}
+		root.children = []pageID{b.root, right}
+		b.root = root.id
 	})
 }
 
+// insert descend récursivement jusqu’à la feuille. Si le nœud visité
+// éclate, la clé séparatrice et le nouveau nœud droit sont remontés.
+func (b *BPTree) insert(id pageID, key string, value Row) (string, pageID, bool) {
+	n := b.node(id)
+
+	if n.leaf {
+		i := b.search(n, key)
+		b.touch(n)
+		if i < len(n.keys) && n.keys[i] == key {
+			n.values[i] = value
+			return "", 0, false
+		}
+		n.keys = insertAt(n.keys, i, key)
+		n.values = insertAt(n.values, i, value)
+		b.size++
+
+		if len(n.keys) <= b.maxKeys() {
+			return "", 0, false
+		}
+		return b.splitLeaf(n)
+	}
+
+	i := b.childIndex(n, key)
+	sep, right, split := b.insert(n.children[i], key, value)
+	if !split {
+		return "", 0, false
+	}
+
+	b.touch(n)
+	n.keys = insertAt(n.keys, i, sep)
+	n.children = insertAt(n.children, i+1, right)
+	if len(n.children) <= b.order {
+		return "", 0, false
+	}
+	return b.splitInternal(n)
+}
+
+func (b *BPTree) splitLeaf(n *node) (string, pageID, bool) {
+	mid := len(n.keys) / 2
+	right := b.alloc(true)
+
+	right.keys = append([]string(nil), n.keys[mid:]...)
+	right.values = append([]Row(nil), n.values[mid:]...)
+	n.keys = n.keys[:mid:mid]
+	n.values = n.values[:mid:mid]
+
+	right.next = n.next
+	n.next = right.id
+
+	return right.keys[0], right.id, true
+}
+
+func (b *BPTree) splitInternal(n *node) (string, pageID, bool) {
+	mid := len(n.keys) / 2
+	sep := n.keys[mid]
+	right := b.alloc(false)
+
+	right.keys = append([]string(nil), n.keys[mid+1:]...)
+	right.children = append([]pageID(nil), n.children[mid+1:]...)
+	n.keys = n.keys[:mid:mid]
+	n.children = n.children[: mid+1 : mid+1]
+
+	return sep, right.id, true
+}
+
 // Get recherche une clé dans l’arbre.
-func (b *BPTree) Get(key string) (map[string]string, bool) {
+func (b *BPTree) Get(key string) (Row, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	// Recherche binaire pour plus d’efficacité
-	i := sort.Search(len(b.data), func(i int) bool {
-		return b.data[i].Key >= key
-	})
+	var value Row
+	var found bool
+	b.guard(func() {
+		n := b.node(b.root)
+		for !n.leaf {
+			n = b.node(n.children[b.childIndex(n, key)])
+		}
 
-	if i < len(b.data) && b.data[i].Key == key {
-		return b.data[i].Value, true
-	}
-	return nil, false
+		i := b.search(n, key)
+		if i < len(n.keys) && n.keys[i] == key {
+			value, found = n.values[i], true
+		}
+	})
+	return value, found
 }
 
+// Delete supprime une clé de l’arbre en fusionnant ou en rééquilibrant
+// les nœuds devenus trop petits.
 func (b *BPTree) Delete(key string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	for i, e := range b.data {
-		if e.Key == key {
-			b.data = append(b.data[:i], b.data[i+1:]...)
+	b.guard(func() {
+		if !b.delete(b.root, key) {
+			return
+		}
+		b.size--
+
+		// Une racine interne sans clé est remplacée par son unique enfant.
+		root := b.node(b.root)
+		if !root.leaf && len(root.keys) == 0 {
+			b.root = root.children[0]
+			b.free(root.id)
+		}
+	})
+}
+
+func (b *BPTree) delete(id pageID, key string) bool {
+	n := b.node(id)
+
+	if n.leaf {
+		i := b.search(n, key)
+		if i >= len(n.keys) || n.keys[i] != key {
+			return false
+		}
+		b.touch(n)
+		n.keys = removeAt(n.keys, i)
+		n.values = removeAt(n.values, i)
+		return true
+	}
+
+	i := b.childIndex(n, key)
+	if !b.delete(n.children[i], key) {
+		return false
+	}
+	if len(b.node(n.children[i]).keys) < b.minKeys() {
+		b.rebalance(n, i)
+	}
+	return true
+}
+
+// rebalance corrige le sous-remplissage de l’enfant i du nœud parent,
+// d’abord en empruntant une clé à un frère, sinon en fusionnant avec lui.
+func (b *BPTree) rebalance(parent *node, i int) {
+	child := b.node(parent.children[i])
+
+	if i > 0 {
+		left := b.node(parent.children[i-1])
+		if len(left.keys) > b.minKeys() {
+			b.borrowFromLeft(parent, i, left, child)
+			return
+		}
+	}
+	if i < len(parent.children)-1 {
+		right := b.node(parent.children[i+1])
+		if len(right.keys) > b.minKeys() {
+			b.borrowFromRight(parent, i, child, right)
 			return
 		}
 	}
+
+	if i > 0 {
+		b.merge(parent, i-1)
+	} else {
+		b.merge(parent, i)
+	}
+}
+
+func (b *BPTree) borrowFromLeft(parent *node, i int, left, child *node) {
+	b.touch(parent, left, child)
+	last := len(left.keys) - 1
+
+	if child.leaf {
+		child.keys = insertAt(child.keys, 0, left.keys[last])
+		child.values = insertAt(child.values, 0, left.values[last])
+		left.keys = left.keys[:last]
+		left.values = left.values[:last]
+		parent.keys[i-1] = child.keys[0]
+		return
+	}
+
+	child.keys = insertAt(child.keys, 0, parent.keys[i-1])
+	child.children = insertAt(child.children, 0, left.children[last+1])
+	parent.keys[i-1] = left.keys[last]
+	left.keys = left.keys[:last]
+	left.children = left.children[:last+1]
+}
+
+func (b *BPTree) borrowFromRight(parent *node, i int, child, right *node) {
+	b.touch(parent, child, right)
+	if child.leaf {
+		child.keys = append(child.keys, right.keys[0])
+		child.values = append(child.values, right.values[0])
+		right.keys = removeAt(right.keys, 0)
+		right.values = removeAt(right.values, 0)
+		parent.keys[i] = right.keys[0]
+		return
+	}
+
+	child.keys = append(child.keys, parent.keys[i])
+	child.children = append(child.children, right.children[0])
+	parent.keys[i] = right.keys[0]
+	right.keys = removeAt(right.keys, 0)
+	right.children = removeAt(right.children, 0)
 }
 
-func (b *BPTree) GetAll() []map[string]string {
+// merge fusionne l’enfant sep+1 du parent dans l’enfant sep.
+func (b *BPTree) merge(parent *node, sep int) {
+	left := b.node(parent.children[sep])
+	right := b.node(parent.children[sep+1])
+	b.touch(parent, left)
+
+	if left.leaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+		left.next = right.next
+	} else {
+		left.keys = append(left.keys, parent.keys[sep])
+		left.keys = append(left.keys, right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+
+	parent.keys = removeAt(parent.keys, sep)
+	parent.children = removeAt(parent.children, sep+1)
+	b.free(right.id)
+}
+
+// firstLeaf renvoie la feuille la plus à gauche.
+func (b *BPTree) firstLeaf() *node {
+	n := b.node(b.root)
+	for !n.leaf {
+		n = b.node(n.children[0])
+	}
+	return n
+}
+
+func (b *BPTree) GetAll() []Row {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	rows := make([]map[string]string, 0, len(b.data))
-	for _, e := range b.data {
-		rows = append(rows, e.Value)
-	}
+	rows := make([]Row, 0, b.size)
+	b.guard(func() {
+		for n := b.firstLeaf(); n != nil; n = b.node(n.next) {
+			rows = append(rows, n.values...)
+		}
+	})
 	return rows
 }
 
+// Scan parcourt les couples (clé, valeur) dans l’ordre des clés, tant que
+// fn renvoie true.
+func (b *BPTree) Scan(fn func(key string, value Row) bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.guard(func() {
+		for n := b.firstLeaf(); n != nil; n = b.node(n.next) {
+			for i, k := range n.keys {
+				if !fn(k, n.values[i]) {
+					return
+				}
+			}
+		}
+	})
+}
+
 // Keys renvoie la liste des clés triées.
 func (b *BPTree) Keys() []string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	keys := make([]string, len(b.data))
-	for i, e := range b.data {
-		keys[i] = e.Key
-	}
+	keys := make([]string, 0, b.size)
+	b.guard(func() {
+		for n := b.firstLeaf(); n != nil; n = b.node(n.next) {
+			keys = append(keys, n.keys...)
+		}
+	})
 	return keys
 }
 
-// Rebuild est appelé après rechargement depuis le disque
-// pour s'assurer que les clés sont bien triées.
-func (b *BPTree) Rebuild() {
+// Len renvoie le nombre de clés stockées.
+func (b *BPTree) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.size
+}
+
+// Flush écrit les nœuds modifiés et l’en-tête sur disque. Lorsque le cache
+// dépasse cacheLimit, les nœuds (désormais propres) en sont retirés.
+func (b *BPTree) Flush() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	sort.Slice(b.data, func(i, j int) bool {
-		return b.data[i].Key < b.data[j].Key
-	})
+	if err := b.stage(); err != nil {
+		return err
+	}
+	if b.pager == nil {
+		return nil
+	}
+	if err := b.pager.flush(); err != nil {
+		return err
+	}
+
+	if len(b.nodes) > cacheLimit {
+		root := b.nodes[b.root]
+		clear(b.nodes)
+		b.nodes[b.root] = root
+	}
+	return nil
+}
+
+// stagedPages sérialise les nœuds modifiés et renvoie les pages qui seront
+// écrites par le prochain Flush, en-tête (page 0) compris.
+func (b *BPTree) stagedPages() (map[pageID][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.stage(); err != nil {
+		return nil, err
+	}
+	if b.pager == nil {
+		return nil, nil
+	}
+	return b.pager.pending(), nil
+}
+
+// stage sérialise les nœuds modifiés et l’en-tête dans les pages du pager,
+// sans rien écrire sur disque.
+func (b *BPTree) stage() error {
+	if err := b.Err(); err != nil {
+		return err
+	}
+	if b.pager == nil {
+		clear(b.dirty)
+		return nil
+	}
+
+	for id := range b.dirty {
+		n := b.nodes[id]
+		pages, err := b.pager.writeChain(n.pages, encodeNode(n))
+		if err != nil {
+			return err
+		}
+		n.pages = pages
+	}
+	clear(b.dirty)
+
+	b.pager.hdr.Root = uint32(b.root)
+	b.pager.hdr.Order = uint32(b.order)
+	b.pager.hdr.Size = uint64(b.size)
+	return nil
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	copy(s[i:], s[i+1:])
+	var zero T
+	s[len(s)-1] = zero
+	return s[:len(s)-1]
 }
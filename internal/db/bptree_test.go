@@ -0,0 +1,260 @@
+package db
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+var intKeys = keyOrder(Schema{Columns: []Column{{Name: "id", Type: TypeInt, PrimaryKey: true}}})
+
+// checkTree vérifie la structure de l’arbre, le chaînage des feuilles et
+// la recherche de chaque clé par rapport au modèle want.
+func checkTree(t *testing.T, b *BPTree, want map[string]Row) {
+	t.Helper()
+	if err := b.Err(); err != nil {
+		t.Fatalf("tree error: %v", err)
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, b.cmp)
+
+	// Structure : clés triées et bornées par les séparateurs du parent,
+	// remplissage des nœuds, feuilles toutes à la même profondeur.
+	leafDepth := -1
+	var walk func(id pageID, lo, hi *string, depth int)
+	walk = func(id pageID, lo, hi *string, depth int) {
+		n := b.node(id)
+		if id != b.root && len(n.keys) < b.minKeys() {
+			t.Fatalf("node %d has %d keys, want at least %d", id, len(n.keys), b.minKeys())
+		}
+		for i, k := range n.keys {
+			if i > 0 && b.cmp(n.keys[i-1], k) >= 0 {
+				t.Fatalf("node %d keys out of order: %q before %q", id, n.keys[i-1], k)
+			}
+			if lo != nil && b.cmp(k, *lo) < 0 || hi != nil && b.cmp(k, *hi) >= 0 {
+				t.Fatalf("node %d key %q outside its separators", id, k)
+			}
+		}
+		if n.leaf {
+			if len(n.keys) > b.maxKeys() {
+				t.Fatalf("leaf %d has %d keys, want at most %d", id, len(n.keys), b.maxKeys())
+			}
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("leaf %d at depth %d, want %d", id, depth, leafDepth)
+			}
+			return
+		}
+		if len(n.children) != len(n.keys)+1 || len(n.children) > b.order {
+			t.Fatalf("node %d has %d keys and %d children", id, len(n.keys), len(n.children))
+		}
+		for i, child := range n.children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = &n.keys[i-1]
+			}
+			if i < len(n.keys) {
+				childHi = &n.keys[i]
+			}
+			walk(child, childLo, childHi, depth+1)
+		}
+	}
+	walk(b.root, nil, nil, 0)
+
+	// Chaînage des feuilles : toutes les clés, dans l’ordre.
+	var chained []string
+	for n := b.firstLeaf(); n != nil; n = b.node(n.next) {
+		chained = append(chained, n.keys...)
+	}
+	if !slices.Equal(chained, keys) {
+		t.Fatalf("leaf chain holds %v, want %v", chained, keys)
+	}
+	if got := b.Keys(); !slices.Equal(got, keys) {
+		t.Fatalf("Keys() = %v, want %v", got, keys)
+	}
+	if b.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", b.Len(), len(want))
+	}
+
+	for k, row := range want {
+		got, ok := b.Get(k)
+		if !ok || !Equal(got["v"], row["v"]) {
+			t.Fatalf("Get(%q) = %v, %v, want %v", k, got, ok, row)
+		}
+	}
+}
+
+func newIntTree(order int) *BPTree {
+	b := newTree(nil, order, intKeys)
+	b.root = b.alloc(true).id
+	return b
+}
+
+func TestBPTreeSplitsAndMerges(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8} {
+		t.Run("order "+strconv.Itoa(order), func(t *testing.T) {
+			b := newIntTree(order)
+			want := make(map[string]Row)
+			r := rand.New(rand.NewSource(int64(order)))
+
+			ids := r.Perm(300)
+			for i, id := range ids {
+				k := Int(int64(id)).Key()
+				row := Row{"v": Int(int64(i))}
+				b.Insert(k, row)
+				want[k] = row
+				checkTree(t, b, want)
+			}
+			if h := height(b); h < 3 {
+				t.Fatalf("tree has height %d, want at least 3", h)
+			}
+
+			// Remplacer une clé existante ne change pas la taille.
+			b.Insert("7", Row{"v": Int(-1)})
+			want["7"] = Row{"v": Int(-1)}
+			checkTree(t, b, want)
+
+			for _, id := range r.Perm(300) {
+				k := Int(int64(id)).Key()
+				b.Delete(k)
+				delete(want, k)
+				checkTree(t, b, want)
+				if _, ok := b.Get(k); ok {
+					t.Fatalf("Get(%q) found a deleted key", k)
+				}
+			}
+			if h := height(b); h != 1 {
+				t.Fatalf("empty tree has height %d, want 1", h)
+			}
+
+			// Supprimer une clé absente est sans effet.
+			b.Delete("1")
+			checkTree(t, b, want)
+		})
+	}
+}
+
+func TestBPTreeOrdersIntKeysByValue(t *testing.T) {
+	b := newIntTree(4)
+	for _, i := range []int64{10, 9, -3, 100, 2, 0, 11} {
+		b.Insert(Int(i).Key(), Row{"v": Int(i)})
+	}
+	want := []string{"-3", "0", "2", "9", "10", "11", "100"}
+	if got := b.Keys(); !slices.Equal(got, want) {
+		t.Fatalf("Keys() = %v, want %v", got, want)
+	}
+
+	texts := NewBPTree(4)
+	for _, k := range want {
+		texts.Insert(k, nil)
+	}
+	if got, want := texts.Keys(), []string{"-3", "0", "10", "100", "11", "2", "9"}; !slices.Equal(got, want) {
+		t.Fatalf("text Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	schema := func(typ ColType) Schema {
+		return Schema{Columns: []Column{{Name: "k", Type: typ, PrimaryKey: true}}}
+	}
+	tests := []struct {
+		typ  ColType
+		a, b string
+		want int
+	}{
+		{TypeInt, "9", "10", -1},
+		{TypeInt, "-10", "-9", -1},
+		{TypeInt, "10", "10", 0},
+		{TypeInt, "10", "abc", -1}, // une clé non numérique vient après
+		{TypeInt, "abc", "abd", -1},
+		{TypeReal, "9.5", "10.0", -1},
+		{TypeReal, "1e+21", "999.0", 1},
+		{TypeDecimal, "9.50", "10.00", -1},
+		{TypeDecimal, "-0.50", "0.25", -1},
+		{TypeString, "9", "10", 1},
+		{TypeDate, "2024-01-09", "2024-01-10", -1},
+	}
+	for _, tt := range tests {
+		cmp := keyOrder(schema(tt.typ))
+		if got := cmp(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: cmp(%q, %q) = %d, want %d", tt.typ, tt.a, tt.b, got, tt.want)
+		}
+		if got := cmp(tt.b, tt.a); got != -tt.want {
+			t.Errorf("%s: cmp(%q, %q) = %d, want %d", tt.typ, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestPagedBPTreeSplitsAndMerges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.tbl")
+	p, err := createPager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newPagedBPTree(p, 4, intKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make(map[string]Row)
+	r := rand.New(rand.NewSource(1))
+	for i, id := range r.Perm(200) {
+		k := Int(int64(id)).Key()
+		want[k] = Row{"v": Int(int64(i))}
+		b.Insert(k, want[k])
+		if i%50 == 0 {
+			if err := b.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, id := range r.Perm(200)[:120] {
+		k := Int(int64(id)).Key()
+		b.Delete(k)
+		delete(want, k)
+	}
+	checkTree(t, b, want)
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	pages := p.hdr.PageCount
+	p.close()
+
+	// Relu depuis le disque, l’arbre est identique ; les pages libérées par
+	// les fusions sont réutilisées avant d’agrandir le fichier.
+	p, err = openPager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	b = openBPTree(p, intKeys)
+	checkTree(t, b, want)
+
+	if p.hdr.FreeHead == 0 {
+		t.Fatal("no page was released by the merges")
+	}
+	for i := int64(1000); p.hdr.FreeHead != 0; i++ {
+		k := Int(i).Key()
+		want[k] = Row{"v": Int(i)}
+		b.Insert(k, want[k])
+		if p.hdr.PageCount != pages && p.hdr.FreeHead != 0 {
+			t.Fatalf("file grew from %d to %d pages while free pages were left", pages, p.hdr.PageCount)
+		}
+	}
+	checkTree(t, b, want)
+}
+
+func height(b *BPTree) int {
+	h := 1
+	for n := b.node(b.root); !n.leaf; n = b.node(n.children[0]) {
+		h++
+	}
+	return h
+}
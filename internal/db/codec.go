@@ -0,0 +1,248 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var errCorrupted = errors.New("corrupted node encoding")
+
+// encodeNode sérialise un nœud du B+ Tree :
+//
+//	leaf     byte
+//	next     uint32
+//	nkeys    uvarint
+//	keys     nkeys × (uvarint longueur, octets)
+//	leaf:    nkeys lignes (voir encodeRow)
+//	internal nkeys+1 × uint32 page enfant
+func encodeNode(n *node) []byte {
+	buf := make([]byte, 0, 256)
+	if n.leaf {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(n.next))
+	buf = binary.AppendUvarint(buf, uint64(len(n.keys)))
+	for _, k := range n.keys {
+		buf = appendString(buf, k)
+	}
+
+	if n.leaf {
+		for _, v := range n.values {
+			buf = encodeRow(buf, v)
+		}
+		return buf
+	}
+	for _, c := range n.children {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(c))
+	}
+	return buf
+}
+
+// decodeNode lit un nœud encodé avec le format de lignes donné.
+func decodeNode(id pageID, data []byte, format uint32) (*node, error) {
+	d := decoder{data: data}
+	n := &node{id: id, leaf: d.byte() == 1}
+	n.next = pageID(d.uint32())
+
+	count := d.uvarint()
+	if count > uint64(len(data)) {
+		return nil, errCorrupted
+	}
+	n.keys = make([]string, count)
+	for i := range n.keys {
+		n.keys[i] = d.string()
+	}
+
+	if n.leaf {
+		n.values = make([]Row, count)
+		for i := range n.values {
+			n.values[i] = decodeRow(&d, format)
+		}
+	} else {
+		n.children = make([]pageID, count+1)
+		for i := range n.children {
+			n.children[i] = pageID(d.uint32())
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return n, nil
+}
+
+// encodeRow ajoute une ligne sous la forme d’un nombre de colonnes suivi
+// des couples (nom, valeur) triés par nom de colonne.
+func encodeRow(buf []byte, row Row) []byte {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = appendString(buf, name)
+		buf = encodeValue(buf, row[name])
+	}
+	return buf
+}
+
+// decodeRow lit une ligne encodée avec le format de lignes donné. Les
+// lignes au format 0 contiennent des chaînes sans type, lues comme des
+// valeurs texte.
+func decodeRow(d *decoder, format uint32) Row {
+	count := d.uvarint()
+	if count > uint64(len(d.data)) {
+		d.err = errCorrupted
+		return nil
+	}
+	row := make(Row, count)
+	for i := uint64(0); i < count; i++ {
+		name := d.string()
+		if format == 0 {
+			row[name] = Text(d.string())
+		} else {
+			row[name] = decodeValue(d)
+		}
+	}
+	return row
+}
+
+// encodeValue ajoute une valeur sous la forme de son type suivi de :
+//
+//	INT     varint
+//	FLOAT   uint64 bits IEEE 754
+//	TEXT    uvarint longueur, octets
+//	BLOB    uvarint longueur, octets
+//	BOOLEAN byte
+//	DECIMAL varint valeur sans échelle, byte échelle
+//	DATE, TIME, TIMESTAMP varint (voir datetime.go)
+func encodeValue(buf []byte, v Value) []byte {
+	buf = append(buf, byte(v.kind))
+	switch v.kind {
+	case KindInt, KindDate, KindTime, KindTimestamp:
+		buf = binary.AppendVarint(buf, v.i)
+	case KindFloat:
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.f))
+	case KindText, KindBlob:
+		buf = appendString(buf, v.s)
+	case KindBool:
+		buf = append(buf, byte(v.i))
+	case KindDecimal:
+		buf = binary.AppendVarint(buf, v.i)
+		buf = append(buf, v.scale)
+	}
+	return buf
+}
+
+func decodeValue(d *decoder) Value {
+	switch kind := Kind(d.byte()); kind {
+	case KindNull:
+		return Value{}
+	case KindInt:
+		return Int(d.varint())
+	case KindFloat:
+		return Float(math.Float64frombits(d.uint64()))
+	case KindText:
+		return Text(d.string())
+	case KindBlob:
+		return Value{kind: KindBlob, s: d.string()}
+	case KindBool:
+		return Bool(d.byte() != 0)
+	case KindDecimal:
+		unscaled := d.varint()
+		return Decimal(unscaled, int(d.byte()))
+	case KindDate, KindTime, KindTimestamp:
+		return Value{kind: kind, i: d.varint()}
+	}
+	if d.err == nil {
+		d.err = errCorrupted
+	}
+	return Value{}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// decoder lit les encodages ci-dessus ; la première erreur est conservée
+// et toute lecture suivante renvoie des valeurs nulles.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = errCorrupted
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.err = errCorrupted
+		return ""
+	}
+	return string(d.take(int(n)))
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	day := time.Date(2024, 2, 29, 13, 45, 30, 123456000, time.UTC)
+	values := []Value{
+		Null(),
+		Int(0),
+		Int(-42),
+		Int(math.MaxInt64),
+		Int(math.MinInt64),
+		Float(3.25),
+		Float(-0.5),
+		Float(math.Inf(-1)),
+		Float(math.NaN()),
+		Text(""),
+		Text("héllo, 世界"),
+		Blob(nil),
+		Blob([]byte{0, 0xFF, 0x10}),
+		Bool(true),
+		Bool(false),
+		Decimal(-12345, 2),
+		Decimal(999999999999999999, 18),
+		Date(day),
+		Date(time.Date(1850, 1, 1, 0, 0, 0, 0, time.UTC)),
+		TimeOfDay(13*time.Hour + 5*time.Microsecond),
+		Timestamp(day),
+	}
+	for _, v := range values {
+		buf := encodeValue(nil, v)
+		d := decoder{data: buf}
+		got := decodeValue(&d)
+		if d.err != nil {
+			t.Fatalf("%s %s: %v", v.Kind(), v, d.err)
+		}
+		if len(d.data) != 0 {
+			t.Errorf("%s %s: %d bytes left after decoding", v.Kind(), v, len(d.data))
+		}
+		if v.Kind() == KindFloat && math.IsNaN(v.Float()) {
+			if !math.IsNaN(got.Float()) {
+				t.Errorf("NaN decoded as %s", got)
+			}
+			continue
+		}
+		if got != v {
+			t.Errorf("%s %s decoded as %s %s", v.Kind(), v, got.Kind(), got)
+		}
+	}
+}
+
+func TestRowRoundTrip(t *testing.T) {
+	row := Row{"id": Int(7), "name": Text("ann"), "price": Decimal(1999, 2), "ok": Bool(true)}
+	buf := encodeRow(nil, row)
+	d := decoder{data: buf}
+	got := decodeRow(&d, rowFormat)
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	if len(got) != len(row) {
+		t.Fatalf("decoded %v, want %v", got, row)
+	}
+	for name, v := range row {
+		if got[name] != v {
+			t.Errorf("column %s = %s, want %s", name, got[name], v)
+		}
+	}
+
+	// Au format 0, les valeurs sont des chaînes sans type.
+	var old []byte
+	old = append(old, 1)
+	old = appendString(old, "id")
+	old = appendString(old, "7")
+	d = decoder{data: old}
+	if got := decodeRow(&d, 0); d.err != nil || got["id"] != Text("7") {
+		t.Fatalf("format 0 row = %v, %v, want id = TEXT 7", got, d.err)
+	}
+}
+
+func TestNodeRoundTrip(t *testing.T) {
+	leaf := &node{
+		id:     3,
+		leaf:   true,
+		keys:   []string{"1", "2", "10"},
+		values: []Row{{"id": Int(1)}, {"id": Int(2), "s": Text("x")}, {}},
+		next:   9,
+	}
+	internal := &node{
+		id:       4,
+		keys:     []string{"5", "50"},
+		children: []pageID{3, 7, 8},
+	}
+	for _, n := range []*node{leaf, internal} {
+		got, err := decodeNode(n.id, encodeNode(n), rowFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.leaf != n.leaf || got.next != n.next || !slices.Equal(got.keys, n.keys) || !slices.Equal(got.children, n.children) {
+			t.Fatalf("decoded %+v, want %+v", got, n)
+		}
+		for i, row := range n.values {
+			if len(got.values[i]) != len(row) {
+				t.Fatalf("row %d = %v, want %v", i, got.values[i], row)
+			}
+		}
+	}
+}
+
+func TestDecodeCorruptedNode(t *testing.T) {
+	n := &node{id: 1, leaf: true, keys: []string{"a", "b"}, values: []Row{{"v": Text("x")}, {"v": Int(1)}}}
+	buf := encodeNode(n)
+	for cut := 0; cut < len(buf); cut++ {
+		if _, err := decodeNode(1, buf[:cut], rowFormat); err == nil {
+			t.Fatalf("decoding %d of %d bytes succeeded", cut, len(buf))
+		}
+	}
+
+	bad := append([]byte(nil), buf...)
+	bad[len(bad)-2] = 200 // type de valeur inconnu
+	if _, err := decodeNode(1, bad, rowFormat); err == nil {
+		t.Fatal("decoding an unknown value kind succeeded")
+	}
+}
@@ -4,19 +4,53 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 )
 
+// Database peut être utilisée en parallèle par plusieurs goroutines
+// exécutant des instructions en mode autocommit, chacune dans son propre
+// instantané. La transaction ouverte par Begin appartient à l’appelant ;
+// les goroutines ayant besoin de leur propre transaction utilisent NewTx.
+// ActiveDB se lit par Active, qui prend le verrou.
 type Database struct {
 	RootPath string
 	ActiveDB string
 	Tables   map[string]*Table
+
+	mu    sync.RWMutex // protège ActiveDB, Tables, wal, clock et tx
+	wal   *wal         // journal d’écriture anticipée de la base active
+	clock *clock       // ordonne les transactions de la base active
+	tx    *Tx          // transaction ouverte par Begin
 }
 
+// NewDatabase ouvre le répertoire racine contenant les bases. Les bases
+// laissées avec un journal d’écriture anticipée non vide par un arrêt
+// brutal sont restaurées.
 func NewDatabase(root string) (*Database, error) {
 	if err := os.MkdirAll(root, 0o755); err != nil {
 		return nil, err
 	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dbPath := filepath.Join(root, entry.Name())
+		if info, err := os.Stat(filepath.Join(dbPath, walFileName)); err != nil || info.Size() == 0 {
+			continue
+		}
+		tables, w, err := openTables(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		w.close()
+		closeAll(tables)
+	}
+
 	return &Database{
 		RootPath: root,
 		Tables:   make(map[string]*Table),
@@ -31,35 +65,59 @@ func (d *Database) CreateDatabase(name string) error {
 	return os.MkdirAll(dbPath, 0o755)
 }
 
+// SetActiveDB ouvre une base et en fait la base active. Si elle ne peut
+// pas être ouverte, la base active le reste.
 func (d *Database) SetActiveDB(name string) error {
 	dbPath := filepath.Join(d.RootPath, name)
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		return fmt.Errorf("database '%s' does not exist", name)
 	}
 
-	d.ActiveDB = name
-	d.Tables = make(map[string]*Table)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tx != nil {
+		return errInTx("switch database")
+	}
+
+	// Les fichiers de la base active sont mis à jour avant l’ouverture de
+	// la nouvelle base, qui peut être la même.
+	if prev := d.clock; prev != nil {
+		prev.commitMu.Lock()
+		defer prev.commitMu.Unlock()
+		if err := d.wal.checkpoint(); err != nil {
+			return err
+		}
+	}
 
-	files, err := os.ReadDir(dbPath)
+	tables, w, err := openTables(dbPath)
 	if err != nil {
 		return err
 	}
+	c := newClock()
+	for _, t := range tables {
+		t.clock = c
+	}
 
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".tbl") {
-			t, err := LoadTable(filepath.Join(dbPath, f.Name()))
-			if err == nil {
-				d.Tables[t.Name] = t
-			}
-		}
+	if d.wal != nil {
+		d.wal.close()
+		closeAll(d.Tables)
 	}
+	d.ActiveDB = name
+	d.Tables = tables
+	d.wal = w
+	d.clock = c
 	return nil
 }
 
 func (d *Database) CreateTable(name string, schema Schema) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.ActiveDB == "" {
 		return fmt.Errorf("no active database (use USE <db>)")
 	}
+	if d.tx != nil {
+		return errInTx("create a table")
+	}
 
 	if _, exists := d.Tables[name]; exists {
 		return fmt.Errorf("table '%s' already exists", name)
@@ -71,18 +129,24 @@ func (d *Database) CreateTable(name string, schema Schema) error {
 	}
 
 	tblPath := filepath.Join(dbPath, name+".tbl")
-	t := &Table{
-		Name:     name,
-		Schema:   schema,
-		FilePath: tblPath,
-		Index:    NewBPTree(4),
+	t, err := createTable(tblPath, name, schema)
+	if err != nil {
+		return err
 	}
 
+	t.wal = d.wal
+	t.clock = d.clock
+
+	// La map est partagée avec le journal, qui la parcourt aux checkpoints.
+	d.clock.commitMu.Lock()
 	d.Tables[name] = t
-	return t.Save()
+	d.clock.commitMu.Unlock()
+	return nil
 }
 
 func (d *Database) Table(name string) (*Table, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	t, ok := d.Tables[name]
 	if !ok {
 		return nil, fmt.Errorf("table '%s' not found", name)
@@ -90,7 +154,16 @@ func (d *Database) Table(name string) (*Table, error) {
 	return t, nil
 }
 
+// Active renvoie le nom de la base active, ou "" si aucune n’est choisie.
+func (d *Database) Active() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.ActiveDB
+}
+
 func (d *Database) ActivePath() (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	if d.ActiveDB == "" {
 		return "", fmt.Errorf("no active database")
 	}
@@ -98,6 +171,8 @@ func (d *Database) ActivePath() (string, error) {
 }
 
 func (d *Database) GetTable(name string) (*Table, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	t, ok := d.Tables[name]
 	if !ok {
 		return nil, fmt.Errorf("table '%s' not found", name)
@@ -121,6 +196,8 @@ func (d *Database) ListDatabases() ([]string, error) {
 }
 
 func (d *Database) ListTables() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	if d.ActiveDB == "" {
 		return nil, fmt.Errorf("no database selected — use USE <database>")
 	}
@@ -139,6 +216,9 @@ func (d *Database) DropDatabase(name string) error {
 		return fmt.Errorf("database '%s' does not exist", name)
 	}
 
+	// La base ne peut pas devenir active pendant sa suppression.
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	if d.ActiveDB == name {
 		return fmt.Errorf("cannot drop active database '%s' — use USE to switch first", name)
 	}
@@ -147,15 +227,31 @@ func (d *Database) DropDatabase(name string) error {
 }
 
 func (d *Database) DropTable(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.ActiveDB == "" {
 		return fmt.Errorf("no database selected — use USE <database>")
 	}
 
+	if d.tx != nil {
+		return errInTx("drop a table")
+	}
+
 	t, exists := d.Tables[name]
 	if !exists {
 		return fmt.Errorf("table '%s' does not exist", name)
 	}
 
+	d.clock.commitMu.Lock()
+	defer d.clock.commitMu.Unlock()
+
+	// Reporte les modifications journalisées dans les fichiers des tables,
+	// pour qu’aucune ne soit rejouée dans une future table du même nom.
+	if err := d.wal.checkpoint(); err != nil {
+		return err
+	}
+
+	t.Close()
 	if err := os.Remove(t.FilePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("error deleting file: %v", err)
 	}
@@ -163,4 +259,30 @@ func (d *Database) DropTable(name string) error {
 	delete(d.Tables, name)
 
 	return nil
-}
\ No newline at end of file
+}
+
+// Close effectue un checkpoint de la base active et libère ses fichiers.
+// Une transaction encore en cours est annulée.
+func (d *Database) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tx != nil {
+		d.tx.Rollback()
+		d.tx = nil
+	}
+	if d.wal == nil {
+		return nil
+	}
+
+	d.clock.commitMu.Lock()
+	err := d.wal.checkpoint()
+	d.wal.close()
+	closeAll(d.Tables)
+	d.clock.commitMu.Unlock()
+
+	d.wal = nil
+	d.clock = nil
+	d.ActiveDB = ""
+	d.Tables = make(map[string]*Table)
+	return err
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetActiveDBKeepsActiveDatabaseOnError(t *testing.T) {
+	d, tbl := openTestDB(t)
+	insert(t, d, tbl, Row{"id": Int(1)})
+
+	if err := d.CreateDatabase("broken"); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(d.RootPath, "broken", "x.tbl")
+	if err := os.WriteFile(bad, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetActiveDB("broken"); err == nil {
+		t.Fatal("SetActiveDB opened a database with an unloadable table")
+	}
+
+	// La base active reste ouverte et utilisable.
+	if d.Active() != "test" {
+		t.Fatalf("active database = %q, want test", d.Active())
+	}
+	insert(t, d, tbl, Row{"id": Int(2)})
+	if n := len(tbl.SelectAll()); n != 2 {
+		t.Fatalf("got %d rows, want 2", n)
+	}
+
+	// Rouvrir la base active conserve ses lignes validées.
+	if err := d.SetActiveDB("test"); err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := d.GetTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert(t, d, tbl, Row{"id": Int(3)})
+	if n := len(tbl.SelectAll()); n != 3 {
+		t.Fatalf("got %d rows after reopening, want 3", n)
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Les dates et heures n’ont pas de fuseau horaire. Une DATE est stockée
+// comme un nombre de jours depuis le 1970-01-01, un TIME en microsecondes
+// depuis minuit et un TIMESTAMP en microsecondes depuis le
+// 1970-01-01 00:00:00.
+const (
+	microsPerSecond = int64(time.Second / time.Microsecond)
+	microsPerDay    = 24 * 60 * 60 * microsPerSecond
+)
+
+// Date renvoie la DATE de t, sans tenir compte de l’heure.
+func Date(t time.Time) Value {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+	return Value{kind: KindDate, i: days}
+}
+
+// Timestamp renvoie le TIMESTAMP de l’heure locale de t, à la
+// microseconde près.
+func Timestamp(t time.Time) Value {
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	utc := time.Date(y, mo, d, h, mi, s, t.Nanosecond(), time.UTC)
+	return Value{kind: KindTimestamp, i: utc.UnixMicro()}
+}
+
+// TimeOfDay renvoie le TIME situé d après minuit ; d est pris modulo un jour.
+func TimeOfDay(d time.Duration) Value {
+	micros := d.Microseconds() % microsPerDay
+	if micros < 0 {
+		micros += microsPerDay
+	}
+	return Value{kind: KindTime, i: micros}
+}
+
+// IsTemporal indique si v est une DATE, un TIME ou un TIMESTAMP.
+func (v Value) IsTemporal() bool {
+	return v.kind == KindDate || v.kind == KindTime || v.kind == KindTimestamp
+}
+
+// Time renvoie une DATE ou un TIMESTAMP sous forme d’heure UTC ; un TIME
+// est renvoyé au 1970-01-01.
+func (v Value) Time() time.Time {
+	switch v.kind {
+	case KindDate:
+		return time.Unix(v.i*24*60*60, 0).UTC()
+	case KindTime, KindTimestamp:
+		return time.UnixMicro(v.i).UTC()
+	}
+	return time.Time{}
+}
+
+// Clock renvoie l’heure du jour d’un TIME ou d’un TIMESTAMP.
+func (v Value) Clock() time.Duration {
+	switch v.kind {
+	case KindTime:
+		return time.Duration(v.i) * time.Microsecond
+	case KindTimestamp:
+		micros := v.i % microsPerDay
+		if micros < 0 {
+			micros += microsPerDay
+		}
+		return time.Duration(micros) * time.Microsecond
+	}
+	return 0
+}
+
+// timestampMicros renvoie une DATE ou un TIMESTAMP en microsecondes, une
+// DATE valant minuit de son jour.
+func (v Value) timestampMicros() int64 {
+	if v.kind == KindDate {
+		return v.i * microsPerDay
+	}
+	return v.i
+}
+
+func formatTemporal(v Value) string {
+	switch v.kind {
+	case KindDate:
+		return v.Time().Format("2006-01-02")
+	case KindTime:
+		return formatClock(v.Clock())
+	}
+	return v.Time().Format("2006-01-02 ") + formatClock(v.Clock())
+}
+
+// formatClock écrit une heure du jour sous la forme HH:MM:SS, suivie de la
+// fraction de seconde s’il y en a une.
+func formatClock(d time.Duration) string {
+	t := time.Time{}.Add(d)
+	if t.Nanosecond() == 0 {
+		return t.Format("15:04:05")
+	}
+	return strings.TrimRight(t.Format("15:04:05.000000"), "0")
+}
+
+var (
+	dateLayouts = []string{"2006-01-02"}
+	timeLayouts = []string{"15:04:05.999999999", "15:04"}
+
+	timestampLayouts = []string{
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+	zonedLayouts = []string{
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z07:00",
+	}
+)
+
+// ParseDate lit une date ISO-8601, YYYY-MM-DD.
+func ParseDate(s string) (Value, error) {
+	t, err := parseLayouts(s, dateLayouts)
+	if err != nil {
+		return Value{}, fmt.Errorf("invalid DATE '%s'", s)
+	}
+	return Date(t), nil
+}
+
+// ParseTime lit une heure ISO-8601, HH:MM[:SS[.ffffff]].
+func ParseTime(s string) (Value, error) {
+	t, err := parseLayouts(s, timeLayouts)
+	if err != nil {
+		return Value{}, fmt.Errorf("invalid TIME '%s'", s)
+	}
+	return TimeOfDay(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), nil
+}
+
+// ParseTimestamp lit une date et une heure ISO-8601, séparées par une
+// espace ou un T ; l’heure peut être omise. Un décalage horaire ou Z
+// convertit l’heure en UTC.
+func ParseTimestamp(s string) (Value, error) {
+	if t, err := parseLayouts(s, timestampLayouts); err == nil {
+		return Timestamp(t), nil
+	}
+	if t, err := parseLayouts(s, zonedLayouts); err == nil {
+		return Timestamp(t.UTC()), nil
+	}
+	return Value{}, fmt.Errorf("invalid TIMESTAMP '%s'", s)
+}
+
+func parseLayouts(s string, layouts []string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// coerceTemporal convertit v en une valeur du type temporel donné : une
+// DATE et un TIMESTAMP se convertissent l’un en l’autre, un TIMESTAMP en
+// son TIME, et les textes sont analysés.
+func coerceTemporal(v Value, kind Kind) (Value, bool) {
+	if v.kind == kind {
+		return v, true
+	}
+	switch {
+	case v.kind == KindText:
+		var parsed Value
+		var err error
+		switch kind {
+		case KindDate:
+			if parsed, err = ParseDate(v.s); err != nil {
+				if parsed, err = ParseTimestamp(v.s); err == nil {
+					parsed = Date(parsed.Time())
+				}
+			}
+		case KindTime:
+			parsed, err = ParseTime(v.s)
+		case KindTimestamp:
+			parsed, err = ParseTimestamp(v.s)
+		}
+		return parsed, err == nil
+	case kind == KindDate && v.kind == KindTimestamp:
+		return Date(v.Time()), true
+	case kind == KindTimestamp && v.kind == KindDate:
+		return Value{kind: KindTimestamp, i: v.timestampMicros()}, true
+	case kind == KindTime && v.kind == KindTimestamp:
+		return TimeOfDay(v.Clock()), true
+	}
+	return Value{}, false
+}
+
+// ParseTemporal lit un texte comme une valeur du type temporel donné.
+func ParseTemporal(s string, kind Kind) (Value, bool) {
+	return coerceTemporal(Text(s), kind)
+}
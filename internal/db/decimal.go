@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxDecimalPrecision est le plus grand nombre de chiffres d’une colonne
+// DECIMAL : les valeurs décimales sont stockées dans un int64 multiplié
+// par 10^scale.
+const MaxDecimalPrecision = 18
+
+// Decimal renvoie le nombre exact unscaled / 10^scale.
+func Decimal(unscaled int64, scale int) Value {
+	return Value{kind: KindDecimal, i: unscaled, scale: uint8(scale)}
+}
+
+// Scale renvoie le nombre de chiffres après la virgule d’une valeur DECIMAL.
+func (v Value) Scale() int { return int(v.scale) }
+
+// Rat renvoie la valeur exacte d’un nombre.
+func (v Value) Rat() *big.Rat {
+	switch v.kind {
+	case KindInt:
+		return new(big.Rat).SetInt64(v.i)
+	case KindDecimal:
+		return new(big.Rat).SetFrac(big.NewInt(v.i), pow10(int(v.scale)))
+	case KindFloat:
+		// La plus courte forme décimale d’un flottant est le nombre dont il a été lu
+		if r, ok := new(big.Rat).SetString(strconv.FormatFloat(v.f, 'f', -1, 64)); ok {
+			return r
+		}
+	}
+	return new(big.Rat)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// DecimalFromRat arrondit r à scale chiffres après la virgule, les moitiés
+// s’éloignant de zéro, et vérifie que le résultat tient en precision
+// chiffres.
+func DecimalFromRat(r *big.Rat, precision, scale int) (Value, error) {
+	n := new(big.Int).Mul(r.Num(), pow10(scale))
+	d := r.Denom()
+	q, m := new(big.Int).QuoRem(n, d, new(big.Int))
+	if m.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(d) >= 0 {
+		q.Add(q, big.NewInt(int64(n.Sign())))
+	}
+	if new(big.Int).Abs(q).Cmp(pow10(precision)) >= 0 {
+		return Value{}, fmt.Errorf("value %s out of range for DECIMAL(%d,%d)", r.FloatString(scale), precision, scale)
+	}
+	return Decimal(q.Int64(), scale), nil
+}
+
+// decimalString formate un décimal sans échelle avec scale chiffres après
+// la virgule.
+func decimalString(unscaled int64, scale int) string {
+	s := strconv.FormatInt(unscaled, 10)
+	if scale == 0 {
+		return s
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// clock ordonne les transactions d’une base ouverte. Chaque transaction
+// lit les tables telles qu’elles étaient à un instantané : l’horodatage du
+// dernier commit publié à son début. Les commits sont sérialisés et publiés
+// seulement une fois appliqués, si bien qu’un instantané n’observe jamais
+// une partie d’un commit.
+type clock struct {
+	commitMu sync.Mutex // sérialise les commits et les checkpoints
+
+	mu     sync.Mutex
+	now    uint64         // horodatage du dernier commit publié
+	active map[uint64]int // instantanés en cours d’utilisation
+}
+
+func newClock() *clock {
+	return &clock{active: make(map[uint64]int)}
+}
+
+func (c *clock) snapshot() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active[c.now]++
+	return c.now
+}
+
+func (c *clock) release(ts uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[ts]--; c.active[ts] <= 0 {
+		delete(c.active, ts)
+	}
+}
+
+// oldest renvoie le plus ancien instantané utilisé, ou le dernier commit.
+func (c *clock) oldest() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	oldest := c.now
+	for ts := range c.active {
+		oldest = min(oldest, ts)
+	}
+	return oldest
+}
+
+// version est un état validé d’une ligne. Les versions d’une clé sont
+// chaînées de la plus récente à la plus ancienne ; la plus ancienne a
+// l’horodatage 0 et contient la ligne telle qu’elle était avant le début de
+// la chaîne.
+type version struct {
+	row  Row    // nil lorsque la ligne n’existe pas
+	ts   uint64 // commit ayant produit cet état
+	prev *version
+}
+
+// visible renvoie l’état de la ligne vu par un instantané.
+func (v *version) visible(ts uint64) *version {
+	for v != nil && v.ts > ts {
+		v = v.prev
+	}
+	return v
+}
+
+// Le B+ Tree d’une table contient toujours les dernières lignes validées.
+// Les clés modifiées pendant que des instantanés plus anciens étaient
+// utilisés ont aussi une chaîne de versions dans Table.versions, dont la
+// tête correspond au B+ Tree ; les lecteurs s’en servent pour trouver la
+// ligne que voit leur instantané. Les chaînes sont élaguées dès qu’aucun
+// instantané n’a plus besoin de leurs anciennes versions.
+
+// getAt renvoie la ligne stockée sous une clé telle que la voit un
+// instantané.
+func (t *Table) getAt(key string, ts uint64) (Row, bool) {
+	t.mvMu.RLock()
+	defer t.mvMu.RUnlock()
+
+	if chain, ok := t.versions[key]; ok {
+		if v := chain.visible(ts); v != nil && v.row != nil {
+			return v.row, true
+		}
+		return nil, false
+	}
+	return t.Index.Get(key)
+}
+
+// rowsAt renvoie les lignes vues par un instantané, dans l’ordre de la clé
+// primaire.
+func (t *Table) rowsAt(ts uint64) []Row {
+	rows := make([]Row, 0, t.Index.Len())
+	t.scanAt(ts, func(_ string, row Row) {
+		rows = append(rows, row)
+	})
+	return rows
+}
+
+// scanAt appelle fn pour chaque ligne vue par un instantané, dans l’ordre
+// de la clé primaire.
+func (t *Table) scanAt(ts uint64, fn func(key string, row Row)) {
+	t.mvMu.RLock()
+	defer t.mvMu.RUnlock()
+
+	keys := make([]string, 0, len(t.versions))
+	for key := range t.versions {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, t.Index.cmp)
+
+	// Fusionne le B+ Tree avec les clés ayant une chaîne de versions.
+	emit := func(key string) {
+		if v := t.versions[key].visible(ts); v != nil && v.row != nil {
+			fn(key, v.row)
+		}
+	}
+	i := 0
+	t.Index.Scan(func(key string, row Row) bool {
+		for ; i < len(keys) && t.Index.cmp(keys[i], key) < 0; i++ {
+			emit(keys[i])
+		}
+		if i < len(keys) && keys[i] == key {
+			emit(keys[i])
+			i++
+		} else {
+			fn(key, row)
+		}
+		return true
+	})
+	for ; i < len(keys); i++ {
+		emit(keys[i])
+	}
+}
+
+// lenAt renvoie le nombre de lignes vues par un instantané.
+func (t *Table) lenAt(ts uint64) int {
+	t.mvMu.RLock()
+	defer t.mvMu.RUnlock()
+
+	n := t.Index.Len()
+	for _, chain := range t.versions {
+		if chain.row != nil {
+			n--
+		}
+		if v := chain.visible(ts); v != nil && v.row != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// checkConflict échoue lorsqu’une clé a été validée par une autre
+// transaction après l’instantané : le premier à valider l’emporte.
+func (t *Table) checkConflict(key string, ts uint64) error {
+	t.mvMu.RLock()
+	defer t.mvMu.RUnlock()
+
+	if chain, ok := t.versions[key]; ok && chain.ts > ts {
+		return fmt.Errorf("could not serialize access: row '%s' of table '%s' was changed by a concurrent transaction", key, t.Name)
+	}
+	return nil
+}
+
+// pushVersion enregistre le nouvel état d’une clé validé à ts. Elle doit
+// être appelée avant la mise à jour du B+ Tree.
+func (t *Table) pushVersion(key string, row Row, ts uint64) {
+	t.mvMu.Lock()
+	defer t.mvMu.Unlock()
+
+	chain, ok := t.versions[key]
+	if !ok {
+		before, _ := t.Index.Get(key)
+		chain = &version{row: before}
+	}
+	t.versions[key] = &version{row: row, ts: ts, prev: chain}
+}
+
+// prune supprime les versions qu’aucun instantané postérieur ou égal à
+// oldest ne peut voir.
+func (t *Table) prune(oldest uint64) {
+	t.mvMu.Lock()
+	defer t.mvMu.Unlock()
+
+	for key, chain := range t.versions {
+		v := chain.visible(oldest)
+		if v == chain {
+			delete(t.versions, key)
+		} else if v != nil {
+			v.prev = nil
+		}
+	}
+}
+
+// dropVersions oublie toutes les chaînes de versions ; valable seulement
+// lorsqu’aucun instantané autre que celui de la transaction qui valide
+// n’est utilisé.
+func (t *Table) dropVersions() {
+	t.mvMu.Lock()
+	defer t.mvMu.Unlock()
+	clear(t.versions)
+}
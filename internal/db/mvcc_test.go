@@ -0,0 +1,147 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// commitAll valide les transactions en parallèle et renvoie leurs erreurs.
+func commitAll(txs []*Tx) []error {
+	errs := make([]error, len(txs))
+	var wg sync.WaitGroup
+	for i, tx := range txs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = tx.Commit()
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// winner vérifie qu’une seule transaction a été validée, les autres
+// échouant avec une erreur de sérialisation, et renvoie son indice.
+func winner(t *testing.T, errs []error) int {
+	t.Helper()
+	won := -1
+	for i, err := range errs {
+		switch {
+		case err == nil && won >= 0:
+			t.Fatalf("transactions %d and %d both committed", won, i)
+		case err == nil:
+			won = i
+		case !strings.Contains(err.Error(), "could not serialize access"):
+			t.Fatalf("transaction %d: %v, want a serialization error", i, err)
+		}
+	}
+	if won < 0 {
+		t.Fatal("no transaction committed")
+	}
+	return won
+}
+
+func TestConcurrentWritesToOneKey(t *testing.T) {
+	d, tbl := openTestDB(t)
+	insert(t, d, tbl, Row{"id": Int(1), "name": Text("ann")})
+
+	// Toutes les transactions lisent la ligne avant qu’aucune ne soit
+	// validée.
+	txs := make([]*Tx, 8)
+	for i := range txs {
+		txs[i], _ = d.NewTx()
+		row, ok := txs[i].Get(tbl, "1")
+		if !ok {
+			t.Fatal("row 1 not found")
+		}
+		row = row.Clone()
+		row["name"] = Text("w" + strconv.Itoa(i))
+		txs[i].Put(tbl, "1", row)
+	}
+	won := winner(t, commitAll(txs))
+
+	if row, _ := tbl.Index.Get("1"); row["name"] != Text("w"+strconv.Itoa(won)) {
+		t.Fatalf("row 1 = %v, want the write of transaction %d", row, won)
+	}
+}
+
+func TestConcurrentInsertsOfOneUniqueValue(t *testing.T) {
+	d, tbl := openTestDB(t)
+
+	txs := make([]*Tx, 8)
+	for i := range txs {
+		txs[i], _ = d.NewTx()
+		if err := txs[i].Insert(tbl, Row{"name": Text("n" + strconv.Itoa(i)), "email": Text("a@x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	won := winner(t, commitAll(txs))
+
+	rows, err := tbl.SelectWhere("email", Text("a@x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != Text("n"+strconv.Itoa(won)) {
+		t.Fatalf("rows holding a@x: %v, want the row of transaction %d", rows, won)
+	}
+	if n := tbl.Index.Len(); n != 1 {
+		t.Fatalf("table has %d rows, want 1", n)
+	}
+}
+
+func TestSnapshotSurvivesConcurrentCommits(t *testing.T) {
+	d, tbl := openTestDB(t)
+	for i := int64(1); i <= 3; i++ {
+		insert(t, d, tbl, Row{"id": Int(i), "name": Text("v0")})
+	}
+	reader, _ := d.NewTx()
+	defer reader.Rollback()
+
+	const commits = 50
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= commits; i++ {
+			tx, _ := d.NewTx()
+			tx.Put(tbl, "1", Row{"id": Int(1), "name": Text("v" + strconv.Itoa(i))})
+			tx.Delete(tbl, "2")
+			tx.Put(tbl, strconv.Itoa(100+i), Row{"id": Int(int64(100 + i))})
+			if err := tx.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// Le lecteur voit les mêmes lignes pendant toute la durée des écritures.
+	for i := 0; i < commits; i++ {
+		rows := reader.Rows(tbl)
+		if len(rows) != 3 {
+			t.Fatalf("reader sees %d rows, want 3", len(rows))
+		}
+		for j, row := range rows {
+			if row["id"] != Int(int64(j+1)) || row["name"] != Text("v0") {
+				t.Fatalf("reader sees row %v", row)
+			}
+		}
+		if n := reader.Len(tbl); n != 3 {
+			t.Fatalf("reader counts %d rows, want 3", n)
+		}
+	}
+	wg.Wait()
+
+	if row, ok := reader.Get(tbl, "2"); !ok || row["name"] != Text("v0") {
+		t.Fatalf("reader Get(2) = %v, %v", row, ok)
+	}
+	after, _ := d.NewTx()
+	defer after.Rollback()
+	if n := after.Len(tbl); n != 2+commits {
+		t.Fatalf("new transaction counts %d rows, want %d", n, 2+commits)
+	}
+	if row, _ := after.Get(tbl, "1"); row["name"] != Text("v"+strconv.Itoa(commits)) {
+		t.Fatalf("new transaction sees row 1 = %v", row)
+	}
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PageSize est la taille en octets de chaque page d’un fichier de table.
+const PageSize = 4096
+
+var pageMagic = [8]byte{'G', 'M', 'S', 'Q', 'L', 'P', 'G', '1'}
+
+// La page 0 d’un fichier de table est la page d’en-tête :
+//
+//	magic      [8]byte
+//	page size  uint32
+//	page count uint32
+//	free head  uint32 première page de la liste libre (0 = vide)
+//	root       uint32 nœud racine du B+ Tree
+//	order      uint32 ordre du B+ Tree
+//	meta       uint32 première page de la chaîne des métadonnées de la table
+//	size       uint64 nombre de clés stockées dans le B+ Tree
+//	format     uint32 encodage des lignes et ordre des clés (voir rowFormat)
+//
+// Toute autre page appartient soit à la liste libre (4 premiers octets :
+// page libre suivante), soit à une chaîne contenant un blob encodé (un nœud
+// du B+ Tree ou les métadonnées de la table). Les pages d’une chaîne
+// commencent par la page suivante de la chaîne et le nombre d’octets utiles
+// stockés dans la page.
+const (
+	chainHeaderSize = 6
+	chainPayload    = PageSize - chainHeaderSize
+)
+
+type fileHeader struct {
+	PageCount uint32
+	FreeHead  uint32
+	Root      uint32
+	Order     uint32
+	Meta      uint32
+	Size      uint64
+	Format    uint32
+}
+
+// rowFormat est le format des fichiers écrits par cette version : depuis
+// le format 1, les valeurs portent leur type (voir encodeValue) ; depuis
+// le format 2, les clés du B+ Tree sont rangées selon keyOrder. Les
+// fichiers plus anciens sont réécrits à l’ouverture.
+const rowFormat = 2
+
+// pager lit et écrit les pages de taille fixe d’un fichier de table. Les
+// pages écrites restent en mémoire jusqu’à flush : seules les pages
+// modifiées depuis le dernier flush atteignent le disque.
+type pager struct {
+	file    *os.File
+	hdr     fileHeader
+	written fileHeader // en-tête tel qu’écrit en dernier sur le disque
+	dirty   map[pageID][]byte
+}
+
+func createPager(path string) (*pager, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &pager{
+		file:  f,
+		hdr:   fileHeader{PageCount: 1, Format: rowFormat},
+		dirty: make(map[pageID][]byte),
+	}, nil
+}
+
+func openPager(path string) (*pager, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, PageSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: cannot read header page: %w", path, err)
+	}
+	if !bytes.Equal(buf[:8], pageMagic[:]) {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, errNotPaged)
+	}
+	if size := binary.LittleEndian.Uint32(buf[8:]); size != PageSize {
+		f.Close()
+		return nil, fmt.Errorf("%s: unsupported page size %d", path, size)
+	}
+
+	p := &pager{file: f, dirty: make(map[pageID][]byte)}
+	p.hdr = fileHeader{
+		PageCount: binary.LittleEndian.Uint32(buf[12:]),
+		FreeHead:  binary.LittleEndian.Uint32(buf[16:]),
+		Root:      binary.LittleEndian.Uint32(buf[20:]),
+		Order:     binary.LittleEndian.Uint32(buf[24:]),
+		Meta:      binary.LittleEndian.Uint32(buf[28:]),
+		Size:      binary.LittleEndian.Uint64(buf[32:]),
+		Format:    binary.LittleEndian.Uint32(buf[40:]),
+	}
+	p.written = p.hdr
+	return p, nil
+}
+
+var errNotPaged = errors.New("not a paged table file")
+
+// isPagedFile indique si le fichier commence par le nombre magique des pages.
+func isPagedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var magic [8]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return false
+	}
+	return magic == pageMagic
+}
+
+func (p *pager) read(id pageID) ([]byte, error) {
+	if id == 0 || uint32(id) >= p.hdr.PageCount {
+		return nil, fmt.Errorf("page %d out of range", id)
+	}
+	if buf, ok := p.dirty[id]; ok {
+		return buf, nil
+	}
+	buf := make([]byte, PageSize)
+	if _, err := p.file.ReadAt(buf, int64(id)*PageSize); err != nil {
+		return nil, fmt.Errorf("page %d: %w", id, err)
+	}
+	return buf, nil
+}
+
+func (p *pager) write(id pageID, buf []byte) {
+	p.dirty[id] = buf
+}
+
+// allocate renvoie une page de la liste libre, ou agrandit le fichier.
+func (p *pager) allocate() (pageID, error) {
+	if p.hdr.FreeHead == 0 {
+		id := pageID(p.hdr.PageCount)
+		p.hdr.PageCount++
+		p.dirty[id] = make([]byte, PageSize)
+		return id, nil
+	}
+
+	id := pageID(p.hdr.FreeHead)
+	buf, err := p.read(id)
+	if err != nil {
+		return 0, err
+	}
+	p.hdr.FreeHead = binary.LittleEndian.Uint32(buf)
+	p.dirty[id] = make([]byte, PageSize)
+	return id, nil
+}
+
+// release ajoute une page en tête de la liste libre.
+func (p *pager) release(id pageID) {
+	buf := make([]byte, PageSize)
+	binary.LittleEndian.PutUint32(buf, p.hdr.FreeHead)
+	p.dirty[id] = buf
+	p.hdr.FreeHead = uint32(id)
+}
+
+// readChain renvoie le blob stocké dans la chaîne commençant à first,
+// ainsi que toutes les pages de la chaîne.
+func (p *pager) readChain(first pageID) ([]byte, []pageID, error) {
+	var data []byte
+	var pages []pageID
+	for id := first; id != 0; {
+		if len(pages) > int(p.hdr.PageCount) {
+			return nil, nil, fmt.Errorf("page %d: cyclic chain", first)
+		}
+		buf, err := p.read(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		n := int(binary.LittleEndian.Uint16(buf[4:]))
+		if n > chainPayload {
+			return nil, nil, fmt.Errorf("page %d: corrupted chain page", id)
+		}
+		data = append(data, buf[chainHeaderSize:chainHeaderSize+n]...)
+		pages = append(pages, id)
+		id = pageID(binary.LittleEndian.Uint32(buf))
+	}
+	return data, pages, nil
+}
+
+// writeChain stocke data dans la chaîne formée de pages (pages[0] reste
+// l’identifiant de la chaîne), en allouant ou libérant des pages au
+// besoin. Elle renvoie les pages qui forment désormais la chaîne.
+func (p *pager) writeChain(pages []pageID, data []byte) ([]pageID, error) {
+	need := (len(data) + chainPayload - 1) / chainPayload
+	if need == 0 {
+		need = 1
+	}
+
+	for len(pages) < need {
+		id, err := p.allocate()
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, id)
+	}
+	for _, id := range pages[need:] {
+		p.release(id)
+	}
+	pages = pages[:need]
+
+	for i, id := range pages {
+		chunk := data[min(i*chainPayload, len(data)):min((i+1)*chainPayload, len(data))]
+		buf := make([]byte, PageSize)
+		if i+1 < len(pages) {
+			binary.LittleEndian.PutUint32(buf, uint32(pages[i+1]))
+		}
+		binary.LittleEndian.PutUint16(buf[4:], uint16(len(chunk)))
+		copy(buf[chainHeaderSize:], chunk)
+		p.write(id, buf)
+	}
+	return pages, nil
+}
+
+// pending renvoie une copie des pages que le prochain flush écrira, y
+// compris la page d’en-tête si elle a changé.
+func (p *pager) pending() map[pageID][]byte {
+	pages := make(map[pageID][]byte, len(p.dirty)+1)
+	for id, buf := range p.dirty {
+		pages[id] = bytes.Clone(buf)
+	}
+	if len(p.dirty) > 0 || p.hdr != p.written {
+		pages[0] = p.headerPage()
+	}
+	return pages
+}
+
+func (p *pager) headerPage() []byte {
+	hdr := make([]byte, PageSize)
+	copy(hdr, pageMagic[:])
+	binary.LittleEndian.PutUint32(hdr[8:], PageSize)
+	binary.LittleEndian.PutUint32(hdr[12:], p.hdr.PageCount)
+	binary.LittleEndian.PutUint32(hdr[16:], p.hdr.FreeHead)
+	binary.LittleEndian.PutUint32(hdr[20:], p.hdr.Root)
+	binary.LittleEndian.PutUint32(hdr[24:], p.hdr.Order)
+	binary.LittleEndian.PutUint32(hdr[28:], p.hdr.Meta)
+	binary.LittleEndian.PutUint64(hdr[32:], p.hdr.Size)
+	binary.LittleEndian.PutUint32(hdr[40:], p.hdr.Format)
+	return hdr
+}
+
+// flush écrit les pages sales et la page d’en-tête, puis synchronise le
+// fichier.
+func (p *pager) flush() error {
+	if len(p.dirty) == 0 && p.hdr == p.written {
+		return nil
+	}
+
+	for id, buf := range p.dirty {
+		if _, err := p.file.WriteAt(buf, int64(id)*PageSize); err != nil {
+			return err
+		}
+	}
+	if _, err := p.file.WriteAt(p.headerPage(), 0); err != nil {
+		return err
+	}
+
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	clear(p.dirty)
+	p.written = p.hdr
+	return nil
+}
+
+func (p *pager) close() error {
+	return p.file.Close()
+}
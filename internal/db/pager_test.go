@@ -0,0 +1,209 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestPager(t *testing.T) (*pager, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "t.tbl")
+	p, err := createPager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.close() })
+	return p, path
+}
+
+func reopen(t *testing.T, p *pager, path string) *pager {
+	t.Helper()
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	p.close()
+	p, err := openPager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.close() })
+	return p
+}
+
+func allocate(t *testing.T, p *pager) pageID {
+	t.Helper()
+	id, err := p.allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestPagerHeader(t *testing.T) {
+	p, path := newTestPager(t)
+	for i := 0; i < 3; i++ {
+		allocate(t, p)
+	}
+	p.hdr.Root = 2
+	p.hdr.Order = 64
+	p.hdr.Meta = 1
+	p.hdr.Size = 1 << 40
+	want := p.hdr
+
+	if pages := p.pending(); pages[0] == nil || !bytes.Equal(pages[0][:8], pageMagic[:]) {
+		t.Fatal("pending pages do not include the header page")
+	}
+
+	p = reopen(t, p, path)
+	if p.hdr != want {
+		t.Fatalf("header = %+v, want %+v", p.hdr, want)
+	}
+	if p.hdr.Format != rowFormat {
+		t.Fatalf("format = %d, want %d", p.hdr.Format, rowFormat)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 4*PageSize {
+		t.Fatalf("file size = %v, %v, want %d", info.Size(), err, 4*PageSize)
+	}
+	if len(p.pending()) != 0 {
+		t.Fatal("a freshly opened pager has pending pages")
+	}
+	if _, err := p.read(0); err == nil {
+		t.Fatal("reading the header page as a data page succeeded")
+	}
+	if _, err := p.read(4); err == nil {
+		t.Fatal("reading past the last page succeeded")
+	}
+}
+
+func TestOpenPagerRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gob.tbl")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'x'}, PageSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if isPagedFile(path) {
+		t.Fatal("isPagedFile accepted a file without the magic number")
+	}
+	if _, err := openPager(path); !errors.Is(err, errNotPaged) {
+		t.Fatalf("openPager = %v, want errNotPaged", err)
+	}
+}
+
+func TestPagerFreeList(t *testing.T) {
+	p, path := newTestPager(t)
+	a, b, c := allocate(t, p), allocate(t, p), allocate(t, p)
+	if a != 1 || b != 2 || c != 3 {
+		t.Fatalf("allocated %d, %d, %d, want 1, 2, 3", a, b, c)
+	}
+
+	// La liste libre est une pile : la dernière page libérée sort la
+	// première.
+	p.release(b)
+	p.release(c)
+	if p.hdr.FreeHead != uint32(c) {
+		t.Fatalf("free head = %d, want %d", p.hdr.FreeHead, c)
+	}
+
+	// Après réouverture, les pages libérées sont réutilisées avant que le
+	// fichier ne grandisse.
+	p = reopen(t, p, path)
+	if got := allocate(t, p); got != c {
+		t.Fatalf("allocate = %d, want %d", got, c)
+	}
+	if got := allocate(t, p); got != b {
+		t.Fatalf("allocate = %d, want %d", got, b)
+	}
+	if p.hdr.FreeHead != 0 || p.hdr.PageCount != 4 {
+		t.Fatalf("free head %d, page count %d, want 0 and 4", p.hdr.FreeHead, p.hdr.PageCount)
+	}
+	if got := allocate(t, p); got != 4 {
+		t.Fatalf("allocate = %d, want 4", got)
+	}
+
+	// Une page réutilisée est remise à zéro.
+	buf, err := p.read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, make([]byte, PageSize)) {
+		t.Fatal("reused page is not zeroed")
+	}
+}
+
+func TestPagerChains(t *testing.T) {
+	p, path := newTestPager(t)
+	blob := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		return data
+	}
+
+	sizes := []int{0, 10, chainPayload, chainPayload + 1, 3*chainPayload + 10}
+	chains := make([][]pageID, len(sizes))
+	for i, n := range sizes {
+		pages, err := p.writeChain([]pageID{allocate(t, p)}, blob(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := max(1, (n+chainPayload-1)/chainPayload); len(pages) != want {
+			t.Fatalf("%d bytes stored in %d pages, want %d", n, len(pages), want)
+		}
+		chains[i] = pages
+	}
+
+	p = reopen(t, p, path)
+	for i, n := range sizes {
+		data, pages, err := p.readChain(chains[i][0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, blob(n)) || len(pages) != len(chains[i]) {
+			t.Fatalf("chain %d: read %d bytes in %d pages, want %d bytes in %d pages", i, len(data), len(pages), n, len(chains[i]))
+		}
+	}
+
+	// Raccourcir une chaîne libère ses pages en trop, sans changer sa
+	// première page ; les rallonger ensuite les réutilise.
+	long := chains[len(chains)-1]
+	count := p.hdr.PageCount
+	pages, err := p.writeChain(long, blob(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0] != long[0] {
+		t.Fatalf("shortened chain = %v, want [%d]", pages, long[0])
+	}
+	if p.hdr.FreeHead == 0 {
+		t.Fatal("shortening a chain released no page")
+	}
+	p = reopen(t, p, path)
+	if data, _, err := p.readChain(long[0]); err != nil || !bytes.Equal(data, blob(5)) {
+		t.Fatalf("shortened chain holds %d bytes, %v", len(data), err)
+	}
+	if _, err := p.writeChain(pages, blob(3*chainPayload)); err != nil {
+		t.Fatal(err)
+	}
+	if p.hdr.PageCount != count {
+		t.Fatalf("page count = %d, want %d", p.hdr.PageCount, count)
+	}
+}
+
+func TestPagerDetectsCyclicChain(t *testing.T) {
+	p, _ := newTestPager(t)
+	id := allocate(t, p)
+	pages, err := p.writeChain([]pageID{id, allocate(t, p)}, make([]byte, chainPayload+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// La dernière page renvoie à la première.
+	buf, _ := p.read(pages[1])
+	buf[0] = byte(pages[0])
+	if _, _, err := p.readChain(pages[0]); err == nil {
+		t.Fatal("readChain followed a cyclic chain without error")
+	}
+}
@@ -1,25 +1,108 @@
 package db
 
 import (
+	"bytes"
 	"encoding/gob"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type ColType string
 
 const (
-	TypeInt    ColType = "INT"
-	TypeString ColType = "STRING"
+	TypeInt     ColType = "INT"
+	TypeString  ColType = "STRING"
+	TypeReal    ColType = "REAL"
+	TypeBool    ColType = "BOOLEAN"
+	TypeDecimal ColType = "DECIMAL"
+
+	TypeDate      ColType = "DATE"
+	TypeTime      ColType = "TIME"
+	TypeTimestamp ColType = "TIMESTAMP"
+
+	TypeBlob ColType = "BLOB"
+)
+
+// Précision et échelle par défaut d’une colonne DECIMAL déclarée sans elles.
+const (
+	DefaultDecimalPrecision = 10
+	DefaultDecimalScale     = 0
 )
 
+// colTypeNames associe les noms de types acceptés par CREATE TABLE aux
+// types de colonnes.
+var colTypeNames = map[string]ColType{
+	"INT":     TypeInt,
+	"INTEGER": TypeInt,
+	"STRING":  TypeString,
+	"TEXT":    TypeString,
+	"VARCHAR": TypeString,
+	"CHAR":    TypeString,
+	"REAL":    TypeReal,
+	"FLOAT":   TypeReal,
+	"DOUBLE":  TypeReal,
+	"BOOLEAN": TypeBool,
+	"BOOL":    TypeBool,
+	"DECIMAL": TypeDecimal,
+	"NUMERIC": TypeDecimal,
+
+	"DATE":      TypeDate,
+	"TIME":      TypeTime,
+	"TIMESTAMP": TypeTimestamp,
+	"DATETIME":  TypeTimestamp,
+
+	"BLOB":  TypeBlob,
+	"BYTEA": TypeBlob,
+}
+
+// ParseColType renvoie le type de colonne nommé name, sans tenir compte de
+// la casse.
+func ParseColType(name string) (ColType, error) {
+	if t, ok := colTypeNames[strings.ToUpper(name)]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown column type '%s'", name)
+}
+
+// normalizeSchema associe aux types de colonnes les noms de types stockés
+// par les versions précédentes, qui acceptaient n’importe quel mot. Les
+// noms inconnus deviennent du texte.
+func normalizeSchema(s Schema) Schema {
+	for i, c := range s.Columns {
+		t, err := ParseColType(string(c.Type))
+		if err != nil {
+			t = TypeString
+		}
+		s.Columns[i].Type = t
+		if t == TypeDecimal && c.Precision == 0 {
+			s.Columns[i].Precision = DefaultDecimalPrecision
+			s.Columns[i].Scale = DefaultDecimalScale
+		}
+	}
+	return s
+}
+
 type Column struct {
 	Name       string
 	Type       ColType
 	PrimaryKey bool
 	NotNull    bool
 	Unique     bool
+	Precision  int // DECIMAL : nombre total de chiffres
+	Scale      int // DECIMAL : chiffres après la virgule
+}
+
+// TypeName renvoie le type de la colonne tel qu’écrit dans CREATE TABLE,
+// par exemple DECIMAL(10,2).
+func (c Column) TypeName() string {
+	if c.Type == TypeDecimal {
+		return fmt.Sprintf("%s(%d,%d)", c.Type, c.Precision, c.Scale)
+	}
+	return string(c.Type)
 }
 
 type Schema struct {
@@ -31,36 +114,148 @@ type Table struct {
 	Schema   Schema
 	FilePath string
 	Index    *BPTree
+
+	wal   *wal   // journal d’écriture anticipée de la base, s’il y en a un
+	clock *clock // partagée par les tables d’une base
+
+	mvMu     sync.RWMutex
+	versions map[string]*version // voir mvcc.go
+
+	uniqOnce sync.Once
+	uniqMu   sync.RWMutex
+	unique   map[string]map[string]string // voir unique.go
+
+	seqMu   sync.Mutex
+	seq     int64 // plus grande clé primaire entière validée ou attribuée
+	seqRead bool  // seq tient compte des lignes du B+ Tree
 }
 
-func (t *Table) Save() error {
-	if err := os.MkdirAll(filepath.Dir(t.FilePath), 0755); err != nil {
-		return err
+// tableOrder est l’ordre du B+ Tree utilisé pour les index des tables.
+const tableOrder = 64
+
+type tableMeta struct {
+	Name   string
+	Schema Schema
+}
+
+// createTable crée un fichier de table paginé vide à path.
+func createTable(path, name string, schema Schema) (*Table, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
 	}
-	f, err := os.Create(t.FilePath)
+	p, err := createPager(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
 
-	enc := gob.NewEncoder(f)
-	data := struct {
-		Name   string
-		Schema Schema
-		Rows   []map[string]string
-	}{
-		Name:   t.Name,
-		Schema: t.Schema,
-		Rows:   t.Index.GetAll(),
+	t, err := initTable(p, path, tableMeta{Name: name, Schema: schema})
+	if err != nil {
+		p.close()
+		os.Remove(path)
+		return nil, err
 	}
-	return enc.Encode(&data)
+	return t, nil
+}
+
+func initTable(p *pager, path string, meta tableMeta) (*Table, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&meta); err != nil {
+		return nil, err
+	}
+	metaPage, err := p.allocate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.writeChain([]pageID{metaPage}, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	p.hdr.Meta = uint32(metaPage)
+
+	index, err := newPagedBPTree(p, tableOrder, keyOrder(meta.Schema))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{
+		Name:     meta.Name,
+		Schema:   meta.Schema,
+		FilePath: path,
+		Index:    index,
+		clock:    newClock(),
+		versions: make(map[string]*version),
+	}
+	return t, t.Save()
+}
+
+// Save écrit les lignes validées dans le fichier de la table. Avec un
+// journal d’écriture anticipée, c’est un checkpoint de toute la base.
+func (t *Table) Save() error {
+	t.clock.commitMu.Lock()
+	defer t.clock.commitMu.Unlock()
+
+	if t.wal == nil {
+		return t.Index.Flush()
+	}
+	return t.wal.checkpoint()
+}
+
+// Close libère le fichier de la table.
+func (t *Table) Close() error {
+	if t.Index.pager == nil {
+		return nil
+	}
+	return t.Index.pager.close()
 }
 
 func LoadTable(path string) (*Table, error) {
-	f, err := os.Open(path)
+	if !isPagedFile(path) {
+		if err := migrateLegacyTable(path); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := openPager(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := p.readChain(pageID(p.hdr.Meta))
 	if err != nil {
+		p.close()
 		return nil, err
 	}
+	var meta tableMeta
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&meta); err != nil {
+		p.close()
+		return nil, fmt.Errorf("%s: invalid table metadata: %w", path, err)
+	}
+	meta.Schema = normalizeSchema(meta.Schema)
+
+	if p.hdr.Format < rowFormat {
+		if err := migrateFormat(path, p, meta); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return LoadTable(path)
+	}
+
+	return &Table{
+		Name:     meta.Name,
+		Schema:   meta.Schema,
+		FilePath: path,
+		Index:    openBPTree(p, keyOrder(meta.Schema)),
+		clock:    newClock(),
+		versions: make(map[string]*version),
+	}, nil
+}
+
+// migrateLegacyTable réécrit au format paginé une table sauvegardée en un
+// seul bloc gob. Le nouveau fichier est construit à côté puis renommé à la
+// place de l’ancien.
+func migrateLegacyTable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
 	var data struct {
@@ -68,25 +263,58 @@ func LoadTable(path string) (*Table, error) {
 		Schema Schema
 		Rows   []map[string]string
 	}
-
-	dec := gob.NewDecoder(f)
-	if err := dec.Decode(&data); err != nil {
-		return nil, err
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return err
 	}
 
-	table := &Table{
-		Name:     data.Name,
-		Schema:   data.Schema,
-		FilePath: path,
-		Index:    NewBPTree(3),
+	rows := make([]Row, len(data.Rows))
+	for i, values := range data.Rows {
+		rows[i] = make(Row, len(values))
+		for name, v := range values {
+			rows[i][name] = Text(v)
+		}
 	}
+	return rewriteTable(path, data.Name, normalizeSchema(data.Schema), rows)
+}
 
-	for _, row := range data.Rows {
-		pk := row[table.PrimaryKey()]
-		table.Index.Insert(pk, row)
+// migrateFormat réécrit une table paginée d’un format antérieur à
+// rowFormat : les lignes ne contenant que des valeurs texte (format 0)
+// reçoivent des valeurs des types des colonnes, et les clés rangées dans
+// l’ordre lexicographique (formats 0 et 1) sont rangées selon keyOrder.
+func migrateFormat(path string, p *pager, meta tableMeta) error {
+	index := openBPTree(p, strings.Compare)
+	rows := index.GetAll()
+	if err := index.Err(); err != nil {
+		return err
 	}
+	p.close()
+	return rewriteTable(path, meta.Name, meta.Schema, rows)
+}
 
-	return table, nil
+// rewriteTable construit à côté un nouveau fichier de table contenant rows
+// et le renomme à la place du fichier path. Les valeurs sont converties
+// dans les types des colonnes lorsque c’est possible.
+func rewriteTable(path, name string, schema Schema, rows []Row) error {
+	tmp := path + ".tmp"
+	t, err := createTable(tmp, name, schema)
+	if err != nil {
+		return err
+	}
+	pk := t.PrimaryKey()
+	for _, row := range rows {
+		row = coerceRow(schema, row)
+		t.Index.Insert(row[pk].Key(), row)
+	}
+	if err := t.Save(); err != nil {
+		t.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := t.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
 func (t *Table) PrimaryKey() string {
@@ -98,49 +326,91 @@ func (t *Table) PrimaryKey() string {
 	return ""
 }
 
-func (t *Table) Insert(values map[string]string) error {
-	cols := t.Schema.ColumnsMap()
-	for name, col := range cols {
-		v := values[name]
-		if col.NotNull && v == "" {
-			return fmt.Errorf("column '%s' cannot be NULL", name)
-		}
-		if col.Unique {
-			rows, _ := t.SelectWhere(name, v)
-			if len(rows) > 0 {
-				return fmt.Errorf("value '%s' already exists for UNIQUE column '%s'", v, name)
+// nextID attribue une valeur de clé primaire entière à une ligne insérée
+// sans clé : la plus grande valeur déjà utilisée plus un. Une valeur n’est
+// jamais attribuée deux fois, même à des transactions concurrentes ou
+// après la suppression des lignes qui la précèdent.
+func (t *Table) nextID() int64 {
+	t.seqMu.Lock()
+	defer t.seqMu.Unlock()
+
+	if !t.seqRead {
+		// Les clés non entières, d’une clé primaire non numérique, sont
+		// ignorées.
+		t.Index.Scan(func(key string, _ Row) bool {
+			if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+				t.seq = max(t.seq, id)
 			}
-		}
+			return true
+		})
+		t.seqRead = true
 	}
+	t.seq++
+	return t.seq
+}
 
-	pkName := t.PrimaryKey()
-	pkVal := values[pkName]
-	if pkVal == "" {
-		pkVal = fmt.Sprintf("%d", len(t.Index.GetAll())+1)
-		values[pkName] = pkVal
+// useID signale une valeur de clé primaire fournie par une insertion, que
+// nextID ne doit plus attribuer.
+func (t *Table) useID(v Value) {
+	id, err := strconv.ParseInt(v.Key(), 10, 64)
+	if err != nil {
+		return
 	}
+	t.seqMu.Lock()
+	defer t.seqMu.Unlock()
+	t.seq = max(t.seq, id)
+}
 
-	t.Index.Insert(pkVal, values)
-
-	return t.Save()
+// Insert ajoute une ligne dans sa propre transaction.
+func (t *Table) Insert(values Row) error {
+	tx := newTx(t.wal, t.clock)
+	if err := tx.Insert(t, values); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (t *Table) SelectWhere(column, value string) ([]map[string]string, error) {
-	all := t.Index.GetAll()
-	var results []map[string]string
-	for _, row := range all {
-		if row[column] == value {
-			results = append(results, row)
+// SelectWhere renvoie les lignes validées dont la colonne vaut value. La
+// ligne est lue par sa clé lorsque la colonne est la clé primaire, par
+// l’index lorsqu’elle est UNIQUE ; les autres colonnes sont parcourues.
+func (t *Table) SelectWhere(column string, value Value) ([]Row, error) {
+	ts := t.clock.snapshot()
+	defer t.clock.release(ts)
+
+	key, keyed := value.Key(), column == t.PrimaryKey()
+	if !keyed && t.isUnique(column) {
+		if key, keyed = t.lookupUnique(column, value); !keyed {
+			return nil, nil
+		}
+	}
+	if keyed {
+		if row, ok := t.getAt(key, ts); ok && Equal(row[column], value) {
+			return []Row{row}, nil
 		}
+		if column == t.PrimaryKey() {
+			return nil, nil
+		}
+		// L’index suit le dernier commit, qui a pu déplacer la valeur
+		// depuis l’instantané.
 	}
+
+	var results []Row
+	t.scanAt(ts, func(_ string, row Row) {
+		if Equal(row[column], value) {
+			results = append(results, row)
+		}
+	})
 	return results, nil
 }
 
-func (t *Table) SelectAll() []map[string]string {
-	return t.Index.GetAll()
+// SelectAll renvoie les lignes validées au dernier commit publié.
+func (t *Table) SelectAll() []Row {
+	ts := t.clock.snapshot()
+	defer t.clock.release(ts)
+	return t.rowsAt(ts)
 }
 
-func (t *Table) Update(whereColumn, whereValue string, updates map[string]string) (int, error) {
+func (t *Table) Update(whereColumn string, whereValue Value, updates Row) (int, error) {
 	rows, err := t.SelectWhere(whereColumn, whereValue)
 	if err != nil {
 		return 0, err
@@ -153,6 +423,7 @@ func (t *Table) Update(whereColumn, whereValue string, updates map[string]string
 	cols := t.Schema.ColumnsMap()
 	pkName := t.PrimaryKey()
 
+	coerced := make(Row, len(updates))
 	for colName, newVal := range updates {
 		col, exists := cols[colName]
 		if !exists {
@@ -163,16 +434,21 @@ func (t *Table) Update(whereColumn, whereValue string, updates map[string]string
 			return 0, fmt.Errorf("cannot modify primary key '%s'", pkName)
 		}
 
-		if col.NotNull && newVal == "" {
-			return 0, fmt.Errorf("column '%s' cannot be NULL", colName)
+		newVal, err := col.Coerce(newVal)
+		if err != nil {
+			return 0, err
 		}
+		if newVal.IsNull() && col.NotNull {
+			return 0, fmt.Errorf("column '%s' is NOT NULL", colName)
+		}
+		coerced[colName] = newVal
 
-		if col.Unique && newVal != "" {
+		if col.Unique {
 			existing, _ := t.SelectWhere(colName, newVal)
 			for _, ex := range existing {
 				isCurrentRow := false
 				for _, row := range rows {
-					if ex[pkName] == row[pkName] {
+					if Equal(ex[pkName], row[pkName]) {
 						isCurrentRow = true
 						break
 					}
@@ -184,30 +460,31 @@ func (t *Table) Update(whereColumn, whereValue string, updates map[string]string
 		}
 	}
 
+	tx := newTx(t.wal, t.clock)
 	count := 0
 	for _, row := range rows {
-		pk := row[pkName]
-		currentRow, found := t.Index.Get(pk)
-		if !found {
-			continue
-		}
-
-		for colName, newVal := range updates {
-			currentRow[colName] = newVal
+		pk := row[pkName].Key()
+		updatedRow := row.Clone()
+		for colName, newVal := range coerced {
+			if newVal.IsNull() {
+				delete(updatedRow, colName)
+			} else {
+				updatedRow[colName] = newVal
+			}
 		}
 
-		t.Index.Insert(pk, currentRow)
+		tx.Put(t, pk, updatedRow)
 		count++
 	}
 
-	if err := t.Save(); err != nil {
+	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
 
 	return count, nil
 }
 
-func (t *Table) Delete(whereColumn, whereValue string) (int, error) {
+func (t *Table) Delete(whereColumn string, whereValue Value) (int, error) {
 	rows, err := t.SelectWhere(whereColumn, whereValue)
 	if err != nil {
 		return 0, err
@@ -218,15 +495,15 @@ func (t *Table) Delete(whereColumn, whereValue string) (int, error) {
 	}
 
 	pkName := t.PrimaryKey()
+	tx := newTx(t.wal, t.clock)
 	count := 0
 
 	for _, row := range rows {
-		pk := row[pkName]
-		t.Index.Delete(pk)
+		tx.Delete(t, row[pkName].Key())
 		count++
 	}
 
-	if err := t.Save(); err != nil {
+	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
 
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var usersSchema = Schema{Columns: []Column{
+	{Name: "id", Type: TypeInt, PrimaryKey: true},
+	{Name: "name", Type: TypeString},
+	{Name: "email", Type: TypeString, Unique: true},
+}}
+
+func TestLoadTableReordersNumericKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.tbl")
+	tbl, err := createTable(path, "users", usersSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fichier au format 1 : clés rangées dans l’ordre lexicographique.
+	tbl.Index.pager.hdr.Format = 1
+	tbl.Index.cmp = strings.Compare
+	for i := int64(1); i <= 12; i++ {
+		tbl.Index.Insert(Int(i).Key(), Row{"id": Int(i)})
+	}
+	if err := tbl.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Close()
+
+	tbl, err = LoadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+	if f := tbl.Index.pager.hdr.Format; f != rowFormat {
+		t.Fatalf("format = %d, want %d", f, rowFormat)
+	}
+	want := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	if got := tbl.Index.Keys(); !slices.Equal(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+	if _, ok := tbl.Index.Get("10"); !ok {
+		t.Fatal("key 10 not found after the rewrite")
+	}
+}
+
+func TestMigrateLegacyTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.tbl")
+	legacy := struct {
+		Name   string
+		Schema Schema
+		Rows   []map[string]string
+	}{
+		Name: "people",
+		Schema: Schema{Columns: []Column{
+			{Name: "id", Type: "int", PrimaryKey: true},
+			{Name: "name", Type: "string"},
+			{Name: "born", Type: "date"},
+			{Name: "misc", Type: "whatever"},
+		}},
+	}
+	for i := 1; i <= 11; i++ {
+		legacy.Rows = append(legacy.Rows, map[string]string{
+			"id":   strconv.Itoa(i),
+			"name": "p" + strconv.Itoa(i),
+			"born": "2000-01-" + fmt.Sprintf("%02d", i),
+			"misc": "x",
+		})
+	}
+	legacy.Rows = append(legacy.Rows, map[string]string{"id": "12", "name": "bad date", "born": "someday"})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err := LoadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPagedFile(path) {
+		t.Fatal("the table file was not rewritten in the paged format")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	types := []ColType{TypeInt, TypeString, TypeDate, TypeString}
+	for i, c := range tbl.Schema.Columns {
+		if c.Type != types[i] {
+			t.Errorf("column %s has type %s, want %s", c.Name, c.Type, types[i])
+		}
+	}
+
+	rows := tbl.SelectAll()
+	if len(rows) != 12 {
+		t.Fatalf("got %d rows, want 12", len(rows))
+	}
+	for i, row := range rows {
+		if row["id"] != Int(int64(i+1)) {
+			t.Fatalf("row %d has id %s %s, want INT %d", i, row["id"].Kind(), row["id"], i+1)
+		}
+	}
+	if born := rows[9]["born"]; born.Kind() != KindDate || born.String() != "2000-01-10" {
+		t.Errorf("born = %s %s, want DATE 2000-01-10", born.Kind(), born)
+	}
+	// Une valeur qui ne se convertit pas est gardée telle quelle.
+	if born := rows[11]["born"]; born != Text("someday") {
+		t.Errorf("born = %s %s, want TEXT someday", born.Kind(), born)
+	}
+	tbl.Close()
+
+	// Le fichier réécrit se rouvre sans nouvelle migration.
+	tbl, err = LoadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+	if row, ok := tbl.Index.Get("12"); !ok || row["name"] != Text("bad date") {
+		t.Fatalf("Get(12) = %v, %v", row, ok)
+	}
+}
+
+func TestTableSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.tbl")
+	tbl, err := createTable(path, "users", usersSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 500; i++ {
+		if err := tbl.Insert(Row{"id": Int(i), "name": Text(strings.Repeat("n", 50))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tbl.Delete("name", Text(strings.Repeat("n", 50))); err != nil {
+		t.Fatal(err)
+	}
+	pages := tbl.Index.pager.hdr.PageCount
+	tbl.Close()
+
+	// Les pages libérées par les suppressions servent aux insertions
+	// suivantes, après réouverture.
+	tbl, err = LoadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+	if n := tbl.Index.Len(); n != 0 {
+		t.Fatalf("reopened table has %d rows, want 0", n)
+	}
+	for i := int64(1); i <= 100; i++ {
+		if err := tbl.Insert(Row{"id": Int(i), "email": Text(strconv.FormatInt(i, 10))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := tbl.Index.pager.hdr.PageCount; got > pages {
+		t.Fatalf("file grew from %d to %d pages", pages, got)
+	}
+	if rows, _ := tbl.SelectWhere("email", Text("42")); len(rows) != 1 || rows[0]["id"] != Int(42) {
+		t.Fatalf("SelectWhere(email, 42) = %v", rows)
+	}
+}
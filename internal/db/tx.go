@@ -0,0 +1,608 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrTxDone est renvoyée lorsqu’une transaction terminée est réutilisée.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// write est la dernière modification d’une clé par une transaction.
+type write struct {
+	row     Row  // nil lorsque la ligne est supprimée
+	existed bool // la table validée contient-elle la clé
+}
+
+// undoEntry annule la modification d’une clé par une transaction.
+type undoEntry struct {
+	table *Table
+	key   string
+	prev  *write // nil si la transaction n’avait pas encore modifié la clé
+}
+
+// uniqueValue est une valeur d’une colonne UNIQUE d’une table.
+type uniqueValue struct {
+	table *Table
+	col   string
+	value string // voir Value.uniqueKey
+}
+
+type savepoint struct {
+	name string
+	undo int // longueur du journal d’annulation à la pose du point de sauvegarde
+}
+
+// Tx regroupe des modifications d’une ou plusieurs tables. Elles restent
+// dans la transaction jusqu’à Commit, qui les inscrit en un seul lot dans
+// le journal d’écriture anticipée puis les applique aux tables ; Rollback
+// les abandonne.
+//
+// Les lectures à travers la transaction voient les lignes validées avant
+// son début (son instantané), recouvertes par ses propres modifications ;
+// les commits des transactions concurrentes restent invisibles. Commit
+// échoue si une autre transaction a validé une modification de l’une des
+// mêmes lignes après l’instantané.
+//
+// Les transactions ouvertes par Begin tiennent aussi un journal
+// d’annulation de leurs modifications, afin que RollbackTo puisse revenir
+// à un point de sauvegarde.
+//
+// Une Tx ne doit pas être utilisée par plusieurs goroutines à la fois ;
+// des goroutines concurrentes utilisent chacune leur transaction.
+type Tx struct {
+	wal        *wal
+	clock      *clock
+	snapshot   uint64
+	writes     map[*Table]map[string]*write
+	written    map[uniqueValue]int // lignes écrites contenant chaque valeur UNIQUE
+	undo       []undoEntry
+	savepoints []savepoint
+	track      bool // tenir le journal d’annulation
+	failed     bool
+	done       bool
+}
+
+func newTx(w *wal, c *clock) *Tx {
+	return &Tx{
+		wal:      w,
+		clock:    c,
+		snapshot: c.snapshot(),
+		writes:   make(map[*Table]map[string]*write),
+		written:  make(map[uniqueValue]int),
+	}
+}
+
+// Get renvoie la ligne stockée sous une valeur de clé primaire.
+func (tx *Tx) Get(t *Table, key string) (Row, bool) {
+	if w, ok := tx.writes[t][key]; ok {
+		return w.row, w.row != nil
+	}
+	return t.getAt(key, tx.snapshot)
+}
+
+// Rows renvoie toutes les lignes de la table dans l’ordre de la clé
+// primaire.
+func (tx *Tx) Rows(t *Table) []Row {
+	writes := tx.writes[t]
+	if len(writes) == 0 {
+		return t.rowsAt(tx.snapshot)
+	}
+
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, t.Index.cmp)
+
+	// Fusionne les lignes validées avec les clés modifiées, les deux dans
+	// l’ordre des clés.
+	rows := make([]Row, 0, t.Index.Len()+len(keys))
+	emit := func(key string) {
+		if row := writes[key].row; row != nil {
+			rows = append(rows, row)
+		}
+	}
+	i := 0
+	t.scanAt(tx.snapshot, func(key string, row Row) {
+		for ; i < len(keys) && t.Index.cmp(keys[i], key) < 0; i++ {
+			emit(keys[i])
+		}
+		if i < len(keys) && keys[i] == key {
+			emit(keys[i])
+			i++
+		} else {
+			rows = append(rows, row)
+		}
+	})
+	for ; i < len(keys); i++ {
+		emit(keys[i])
+	}
+	return rows
+}
+
+// Len renvoie le nombre de lignes de la table.
+func (tx *Tx) Len(t *Table) int {
+	n := t.lenAt(tx.snapshot)
+	for _, w := range tx.writes[t] {
+		switch {
+		case w.row != nil && !w.existed:
+			n++
+		case w.row == nil && w.existed:
+			n--
+		}
+	}
+	return n
+}
+
+// Put écrit une ligne sous une valeur de clé primaire.
+func (tx *Tx) Put(t *Table, key string, row Row) {
+	tx.set(t, key, row)
+}
+
+// Delete supprime la ligne stockée sous une valeur de clé primaire.
+func (tx *Tx) Delete(t *Table, key string) {
+	tx.set(t, key, nil)
+}
+
+func (tx *Tx) set(t *Table, key string, row Row) {
+	writes, ok := tx.writes[t]
+	if !ok {
+		writes = make(map[string]*write)
+		tx.writes[t] = writes
+	}
+
+	w, ok := writes[key]
+	if tx.track {
+		entry := undoEntry{table: t, key: key}
+		if ok {
+			prev := *w
+			entry.prev = &prev
+		}
+		tx.undo = append(tx.undo, entry)
+	}
+	if !ok {
+		_, existed := t.getAt(key, tx.snapshot)
+		w = &write{existed: existed}
+		writes[key] = w
+	}
+	tx.count(t, w.row, -1)
+	w.row = row
+	tx.count(t, row, 1)
+}
+
+// count ajoute delta au nombre de lignes écrites contenant chacune des
+// valeurs UNIQUE de row.
+func (tx *Tx) count(t *Table, row Row, delta int) {
+	for _, col := range t.Schema.Columns {
+		v, ok := row[col.Name]
+		if !col.Unique || !ok {
+			continue
+		}
+		uv := uniqueValue{t, col.Name, v.uniqueKey()}
+		if tx.written[uv] += delta; tx.written[uv] == 0 {
+			delete(tx.written, uv)
+		}
+	}
+}
+
+// Savepoint marque l’état courant de la transaction sous un nom. Les noms
+// peuvent être réutilisés : le point de sauvegarde le plus récent
+// l’emporte.
+func (tx *Tx) Savepoint(name string) {
+	tx.savepoints = append(tx.savepoints, savepoint{name: name, undo: len(tx.undo)})
+}
+
+// Release oublie un point de sauvegarde et tous ceux posés après lui, en
+// conservant les modifications faites depuis.
+func (tx *Tx) Release(name string) error {
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// RollbackTo annule les modifications faites depuis un point de
+// sauvegarde, qui reste posé, et oublie les points posés après lui. Une
+// transaction en échec redevient utilisable.
+func (tx *Tx) RollbackTo(name string) error {
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+
+	sp := tx.savepoints[i]
+	for j := len(tx.undo) - 1; j >= sp.undo; j-- {
+		e := tx.undo[j]
+		tx.count(e.table, tx.writes[e.table][e.key].row, -1)
+		if e.prev == nil {
+			delete(tx.writes[e.table], e.key)
+		} else {
+			tx.writes[e.table][e.key] = e.prev
+			tx.count(e.table, e.prev.row, 1)
+		}
+	}
+	tx.undo = tx.undo[:sp.undo]
+	tx.savepoints = tx.savepoints[:i+1]
+	tx.failed = false
+	return nil
+}
+
+func (tx *Tx) findSavepoint(name string) (int, error) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(tx.savepoints[i].name, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint '%s' does not exist", name)
+}
+
+// HasSavepoints indique si un point de sauvegarde est posé.
+func (tx *Tx) HasSavepoints() bool {
+	return len(tx.savepoints) > 0
+}
+
+// Fail marque la transaction en échec après l’erreur d’une instruction :
+// elle ne peut alors qu’être annulée, entièrement ou jusqu’à un point de
+// sauvegarde.
+func (tx *Tx) Fail() {
+	tx.failed = true
+}
+
+// Failed indique si la transaction attend une annulation.
+func (tx *Tx) Failed() bool {
+	return tx.failed
+}
+
+// Insert vérifie les contraintes du schéma sur une nouvelle ligne,
+// convertit ses valeurs dans les types des colonnes et l’écrit, en générant
+// la valeur de clé primaire lorsqu’elle manque.
+func (tx *Tx) Insert(t *Table, values Row) error {
+	cols := t.Schema.ColumnsMap()
+	row := make(Row, len(values))
+	for name, v := range values {
+		col, exists := cols[name]
+		if !exists {
+			return fmt.Errorf("column '%s' does not exist", name)
+		}
+		v, err := col.Coerce(v)
+		if err != nil {
+			return err
+		}
+		if !v.IsNull() {
+			row[name] = v
+		}
+	}
+
+	for name, col := range cols {
+		v, ok := row[name]
+		if col.NotNull && !ok {
+			return fmt.Errorf("column '%s' cannot be NULL", name)
+		}
+		// les NULL n’entrent jamais en collision
+		if col.Unique && ok && tx.holds(t, name, v) {
+			return fmt.Errorf("value '%s' already exists for UNIQUE column '%s'", v, name)
+		}
+	}
+
+	pkName := t.PrimaryKey()
+	pkVal, ok := row[pkName]
+	if ok {
+		t.useID(pkVal)
+	} else {
+		pkVal = Int(t.nextID())
+		if col, exists := cols[pkName]; exists {
+			var err error
+			if pkVal, err = col.Coerce(pkVal); err != nil {
+				return err
+			}
+		}
+		row[pkName] = pkVal
+	}
+
+	if _, exists := tx.Get(t, pkVal.Key()); exists {
+		return fmt.Errorf("duplicate primary key: value '%s' already exists for column '%s'", pkVal, pkName)
+	}
+	tx.Put(t, pkVal.Key(), row)
+	return nil
+}
+
+// holds indique si une ligne vue par la transaction contient la valeur v
+// dans la colonne UNIQUE col : une ligne qu’elle a écrite, ou la ligne
+// validée que l’index désigne si elle ne l’a pas modifiée et que son
+// instantané la voit avec cette valeur.
+func (tx *Tx) holds(t *Table, col string, v Value) bool {
+	if tx.written[uniqueValue{t, col, v.uniqueKey()}] > 0 {
+		return true
+	}
+	key, ok := t.lookupUnique(col, v)
+	if !ok {
+		return false
+	}
+	if _, changed := tx.writes[t][key]; changed {
+		return false
+	}
+	row, ok := t.getAt(key, tx.snapshot)
+	return ok && Equal(row[col], v)
+}
+
+// Commit rend les modifications durables et visibles des transactions
+// suivantes.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if tx.failed {
+		tx.Rollback()
+		return errors.New("transaction was aborted by an error and has been rolled back")
+	}
+	defer tx.finish()
+
+	tables := make([]*Table, 0, len(tx.writes))
+	for t, writes := range tx.writes {
+		if len(writes) > 0 {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	tx.clock.commitMu.Lock()
+	defer tx.clock.commitMu.Unlock()
+
+	var recs []walRecord
+	var targets []*Table // table de chaque enregistrement
+	for _, t := range tables {
+		keys := make([]string, 0, len(tx.writes[t]))
+		for key := range tx.writes[t] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := t.checkConflict(key, tx.snapshot); err != nil {
+				return err
+			}
+			if row := tx.writes[t][key].row; row != nil {
+				recs = append(recs, walRecord{Op: walPut, Table: t.Name, Key: key, Row: row})
+			} else {
+				recs = append(recs, walRecord{Op: walDelete, Table: t.Name, Key: key})
+			}
+			targets = append(targets, t)
+		}
+		if err := tx.checkUnique(t, keys); err != nil {
+			return err
+		}
+	}
+
+	if tx.wal != nil {
+		if err := tx.wal.commit(recs); err != nil {
+			return err
+		}
+	}
+
+	apply := func() {
+		for i, rec := range recs {
+			t := targets[i]
+			if rec.Op == walPut {
+				t.putRow(rec.Key, rec.Row)
+			} else {
+				t.deleteRow(rec.Key)
+			}
+		}
+	}
+
+	c := tx.clock
+	c.mu.Lock()
+	ts := c.now + 1
+	if len(c.active) == 1 && c.active[tx.snapshot] == 1 {
+		// Seule cette transaction détient un instantané : aucun lecteur ne
+		// peut voir les lignes changer, et les nouveaux instantanés
+		// attendent que le commit soit appliqué.
+		for _, t := range tables {
+			t.dropVersions()
+		}
+		apply()
+		c.now = ts
+		c.mu.Unlock()
+	} else {
+		c.mu.Unlock()
+		for i, rec := range recs {
+			targets[i].pushVersion(rec.Key, rec.Row, ts)
+		}
+		apply()
+		c.mu.Lock()
+		c.now = ts
+		c.mu.Unlock()
+	}
+
+	tx.finish()
+	if tx.wal == nil {
+		for _, t := range tables {
+			if err := t.Index.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return tx.wal.checkpointIfFull()
+}
+
+// checkUnique signale une valeur d’une colonne UNIQUE écrite par la
+// transaction dans plusieurs lignes, ou qu’une ligne qu’elle n’a pas
+// modifiée contient aussi. Insert ne vérifie que l’instantané ;
+// checkUnique voit aussi les lignes validées depuis, qui font échouer le
+// commit comme un conflit. Elle doit être appelée avec commitMu
+// verrouillé, pour que l’index contienne les dernières lignes validées.
+func (tx *Tx) checkUnique(t *Table, keys []string) error {
+	writes := tx.writes[t]
+	for _, col := range t.Schema.Columns {
+		if !col.Unique {
+			continue
+		}
+		for _, key := range keys {
+			// les NULL n’entrent jamais en collision
+			v, ok := writes[key].row[col.Name]
+			if !ok {
+				continue
+			}
+			if tx.written[uniqueValue{t, col.Name, v.uniqueKey()}] > 1 {
+				return fmt.Errorf("value '%s' already exists for UNIQUE column '%s'", v, col.Name)
+			}
+			clash, ok := t.lookupUnique(col.Name, v)
+			if _, changed := writes[clash]; !ok || changed {
+				continue
+			}
+			if old, ok := t.getAt(clash, tx.snapshot); ok && Equal(old[col.Name], v) {
+				return fmt.Errorf("value '%s' already exists for UNIQUE column '%s'", v, col.Name)
+			}
+			return fmt.Errorf("could not serialize access: value '%s' of UNIQUE column '%s' of table '%s' was written by a concurrent transaction", v, col.Name, t.Name)
+		}
+	}
+	return nil
+}
+
+// Rollback abandonne les modifications de la transaction.
+func (tx *Tx) Rollback() {
+	tx.finish()
+	tx.writes = nil
+	tx.written = nil
+	tx.undo = nil
+	tx.savepoints = nil
+}
+
+// finish termine la transaction, libère son instantané et supprime les
+// versions de lignes dont plus aucun instantané n’a besoin.
+func (tx *Tx) finish() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.clock.release(tx.snapshot)
+
+	oldest := tx.clock.oldest()
+	for t := range tx.writes {
+		t.prune(oldest)
+	}
+}
+
+// NewTx démarre une transaction sur la base active, indépendante de la
+// transaction ouverte par Begin.
+func (d *Database) NewTx() (*Tx, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.newTx()
+}
+
+// newTx est NewTx, appelée avec d.mu verrouillé.
+func (d *Database) newTx() (*Tx, error) {
+	if d.ActiveDB == "" {
+		return nil, errors.New("no database selected — use USE <database>")
+	}
+	return newTx(d.wal, d.clock), nil
+}
+
+// Begin ouvre la transaction renvoyée par Tx jusqu’à Commit ou Rollback.
+func (d *Database) Begin() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tx != nil {
+		return errors.New("a transaction is already in progress")
+	}
+	tx, err := d.newTx()
+	if err != nil {
+		return err
+	}
+	tx.track = true
+	d.tx = tx
+	return nil
+}
+
+// Tx renvoie la transaction ouverte par Begin, ou nil.
+func (d *Database) Tx() *Tx {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.tx
+}
+
+// end détache la transaction ouverte par Begin, ou renvoie nil.
+func (d *Database) end() *Tx {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx := d.tx
+	d.tx = nil
+	return tx
+}
+
+// Commit valide la transaction ouverte par Begin.
+func (d *Database) Commit() error {
+	tx := d.end()
+	if tx == nil {
+		return errors.New("no transaction in progress")
+	}
+	return tx.Commit()
+}
+
+// Rollback abandonne la transaction ouverte par Begin.
+func (d *Database) Rollback() error {
+	tx := d.end()
+	if tx == nil {
+		return errors.New("no transaction in progress")
+	}
+	tx.Rollback()
+	return nil
+}
+
+// Savepoint pose un point de sauvegarde dans la transaction ouverte par
+// Begin.
+func (d *Database) Savepoint(name string) error {
+	tx := d.Tx()
+	if tx == nil {
+		return errors.New("SAVEPOINT can only be used inside a transaction")
+	}
+	if tx.failed {
+		return ErrTxAborted
+	}
+	tx.Savepoint(name)
+	return nil
+}
+
+// Release libère un point de sauvegarde de la transaction ouverte par
+// Begin.
+func (d *Database) Release(name string) error {
+	tx := d.Tx()
+	if tx == nil {
+		return errors.New("RELEASE can only be used inside a transaction")
+	}
+	if tx.failed {
+		return ErrTxAborted
+	}
+	return tx.Release(name)
+}
+
+// RollbackTo ramène la transaction ouverte par Begin à un point de
+// sauvegarde.
+func (d *Database) RollbackTo(name string) error {
+	tx := d.Tx()
+	if tx == nil {
+		return errors.New("ROLLBACK TO can only be used inside a transaction")
+	}
+	return tx.RollbackTo(name)
+}
+
+// ErrTxAborted est renvoyée pour les instructions envoyées à une
+// transaction en échec.
+var ErrTxAborted = errors.New("current transaction is aborted — use ROLLBACK TO <savepoint> or ROLLBACK")
+
+// errInTx est renvoyée par les opérations impossibles dans une
+// transaction.
+func errInTx(op string) error {
+	return fmt.Errorf("cannot %s inside a transaction — COMMIT or ROLLBACK first", op)
+}
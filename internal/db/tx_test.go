@@ -0,0 +1,208 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// openTestDB ouvre une base vide dans un répertoire temporaire, avec la
+// table users.
+func openTestDB(t *testing.T) (*Database, *Table) {
+	t.Helper()
+	d, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CreateDatabase("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetActiveDB("test"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if err := d.CreateTable("users", usersSchema); err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := d.GetTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, tbl
+}
+
+// insert ajoute une ligne dans sa propre transaction.
+func insert(t *testing.T, d *Database, tbl *Table, row Row) {
+	t.Helper()
+	tx, err := d.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(tbl, row); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertGeneratesKeysAfterDelete(t *testing.T) {
+	d, tbl := openTestDB(t)
+	for _, name := range []string{"ann", "bob", "cat"} {
+		insert(t, d, tbl, Row{"name": Text(name)})
+	}
+	if _, err := tbl.Delete("name", Text("ann")); err != nil {
+		t.Fatal(err)
+	}
+	insert(t, d, tbl, Row{"name": Text("dan")})
+
+	rows := tbl.SelectAll()
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3: %v", len(rows), rows)
+	}
+	names := make(map[string]bool)
+	ids := make(map[int64]bool)
+	for _, row := range rows {
+		names[row["name"].String()] = true
+		ids[row["id"].Int()] = true
+	}
+	if len(names) != 3 || !names["bob"] || !names["cat"] || !names["dan"] {
+		t.Fatalf("got names %v, want bob, cat and dan", names)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("got ids %v, want 3 distinct ids", ids)
+	}
+}
+
+func TestInsertRejectsDuplicatePrimaryKey(t *testing.T) {
+	d, tbl := openTestDB(t)
+	insert(t, d, tbl, Row{"id": Int(1), "name": Text("ann")})
+
+	tx, _ := d.NewTx()
+	defer tx.Rollback()
+	err := tx.Insert(tbl, Row{"id": Int(1), "name": Text("bob")})
+	if err == nil || !strings.Contains(err.Error(), "duplicate primary key") {
+		t.Fatalf("got error %v, want a duplicate primary key error", err)
+	}
+
+	// Une clé insérée par la transaction elle-même est aussi un doublon.
+	if err := tx.Insert(tbl, Row{"id": Int(2), "name": Text("bob")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(tbl, Row{"id": Int(2), "name": Text("cat")}); err == nil {
+		t.Fatal("inserting key 2 twice in one transaction succeeded")
+	}
+
+	// La clé générée suit la plus grande clé fournie.
+	if err := tx.Insert(tbl, Row{"name": Text("dan")}); err != nil {
+		t.Fatal(err)
+	}
+	if row, ok := tx.Get(tbl, "3"); !ok || row["name"].String() != "dan" {
+		t.Fatalf("generated row = %v, %v, want dan under key 3", row, ok)
+	}
+}
+
+func TestConcurrentInsertsGetDistinctKeys(t *testing.T) {
+	d, tbl := openTestDB(t)
+	tx1, _ := d.NewTx()
+	tx2, _ := d.NewTx()
+	if err := tx1.Insert(tbl, Row{"name": Text("ann")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx2.Insert(tbl, Row{"name": Text("bob")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tbl.SelectAll()); n != 2 {
+		t.Fatalf("got %d rows, want 2", n)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	d, tbl := openTestDB(t)
+	insert(t, d, tbl, Row{"id": Int(1), "name": Text("ann"), "email": Text("a@x")})
+	insert(t, d, tbl, Row{"id": Int(2), "name": Text("bob"), "email": Text("b@x")})
+
+	tx, _ := d.NewTx()
+	err := tx.Insert(tbl, Row{"name": Text("cat"), "email": Text("a@x")})
+	if err == nil || !strings.Contains(err.Error(), "already exists for UNIQUE column 'email'") {
+		t.Fatalf("got error %v, want a UNIQUE violation", err)
+	}
+	tx.Rollback()
+
+	// La valeur libérée par une mise à jour peut être reprise.
+	if n, err := tbl.Update("id", Int(1), Row{"email": Text("c@x")}); err != nil || n != 1 {
+		t.Fatalf("Update = %d, %v", n, err)
+	}
+	insert(t, d, tbl, Row{"id": Int(3), "name": Text("cat"), "email": Text("a@x")})
+	if _, err := tbl.Update("id", Int(2), Row{"email": Text("c@x")}); err == nil {
+		t.Fatal("Update to a value held by another row succeeded")
+	}
+
+	// Deux lignes écrites avec la même valeur par une transaction.
+	tx, _ = d.NewTx()
+	tx.Put(tbl, "1", Row{"id": Int(1), "email": Text("z@x")})
+	tx.Put(tbl, "2", Row{"id": Int(2), "email": Text("z@x")})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("commit of two rows with the same UNIQUE value succeeded")
+	}
+
+	tests := []struct {
+		col   string
+		value Value
+		want  []int64
+	}{
+		{"id", Int(2), []int64{2}},
+		{"id", Int(9), nil},
+		{"email", Text("a@x"), []int64{3}},
+		{"email", Text("c@x"), []int64{1}},
+		{"email", Text("b@x"), []int64{2}},
+		{"email", Text("q@x"), nil},
+		{"name", Text("cat"), []int64{3}},
+	}
+	for _, tt := range tests {
+		rows, err := tbl.SelectWhere(tt.col, tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, row := range rows {
+			got = append(got, row["id"].Int())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SelectWhere(%s, %s) = %v, want %v", tt.col, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueValuesFollowSavepoints(t *testing.T) {
+	d, tbl := openTestDB(t)
+	if err := d.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	tx := d.Tx()
+	tx.Savepoint("s")
+	if err := tx.Insert(tbl, Row{"id": Int(1), "email": Text("a@x")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.RollbackTo("s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(tbl, Row{"id": Int(2), "email": Text("a@x")}); err != nil {
+		t.Fatalf("value released by ROLLBACK TO is still taken: %v", err)
+	}
+	if err := tx.Insert(tbl, Row{"id": Int(3), "email": Text("a@x")}); err == nil {
+		t.Fatal("second insert of a@x in the transaction succeeded")
+	}
+	if err := d.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := tbl.SelectWhere("email", Text("a@x")); len(rows) != 1 || rows[0]["id"].Int() != 2 {
+		t.Fatalf("rows holding a@x: %v", rows)
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+// Chaque colonne UNIQUE d’une table a un index associant les valeurs des
+// dernières lignes validées à la clé de la ligne qui les contient. Comme le
+// B+ Tree, il est tenu à jour par l’application des commits et par la
+// relecture du journal ; il est construit au premier besoin.
+
+// putRow écrit une ligne validée dans le B+ Tree et dans l’index des
+// colonnes UNIQUE.
+func (t *Table) putRow(key string, row Row) {
+	if !t.hasUnique() {
+		t.Index.Insert(key, row)
+		return
+	}
+	old, _ := t.Index.Get(key)
+	t.Index.Insert(key, row)
+	t.reindex(key, old, row)
+}
+
+// deleteRow supprime une ligne validée du B+ Tree et de l’index des
+// colonnes UNIQUE.
+func (t *Table) deleteRow(key string) {
+	if !t.hasUnique() {
+		t.Index.Delete(key)
+		return
+	}
+	old, _ := t.Index.Get(key)
+	t.Index.Delete(key)
+	t.reindex(key, old, nil)
+}
+
+func (t *Table) hasUnique() bool {
+	for _, c := range t.Schema.Columns {
+		if c.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// reindex remplace dans l’index les valeurs de l’ancienne ligne stockée
+// sous key par celles de la nouvelle. Rejouer une même modification est
+// sans effet, ce qui permet à buildUnique de parcourir le B+ Tree pendant
+// qu’un commit est appliqué.
+func (t *Table) reindex(key string, old, row Row) {
+	t.uniqMu.Lock()
+	defer t.uniqMu.Unlock()
+	if t.unique == nil {
+		return
+	}
+
+	for col, values := range t.unique {
+		if v, ok := old[col]; ok && values[v.uniqueKey()] == key {
+			delete(values, v.uniqueKey())
+		}
+		if v, ok := row[col]; ok {
+			values[v.uniqueKey()] = key
+		}
+	}
+}
+
+// lookupUnique renvoie la clé de la dernière ligne validée dont la colonne
+// UNIQUE col vaut v.
+func (t *Table) lookupUnique(col string, v Value) (string, bool) {
+	t.uniqOnce.Do(t.buildUnique)
+
+	t.uniqMu.RLock()
+	defer t.uniqMu.RUnlock()
+	key, ok := t.unique[col][v.uniqueKey()]
+	return key, ok
+}
+
+func (t *Table) buildUnique() {
+	t.uniqMu.Lock()
+	defer t.uniqMu.Unlock()
+
+	index := make(map[string]map[string]string)
+	for _, c := range t.Schema.Columns {
+		if c.Unique {
+			index[c.Name] = make(map[string]string)
+		}
+	}
+	t.Index.Scan(func(key string, row Row) bool {
+		for col, values := range index {
+			if v, ok := row[col]; ok {
+				values[v.uniqueKey()] = key
+			}
+		}
+		return true
+	})
+	t.unique = index
+}
+
+// isUnique indique si la colonne col est UNIQUE.
+func (t *Table) isUnique(col string) bool {
+	for _, c := range t.Schema.Columns {
+		if c.Name == col {
+			return c.Unique
+		}
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Kind est le type d’une Value.
+type Kind uint8
+
+const (
+	KindNull Kind = iota
+	KindInt
+	KindFloat
+	KindText
+	KindBool
+	KindDecimal
+	KindDate
+	KindTime
+	KindTimestamp
+	KindBlob
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindInt:
+		return "INT"
+	case KindFloat:
+		return "FLOAT"
+	case KindText:
+		return "TEXT"
+	case KindBool:
+		return "BOOLEAN"
+	case KindDecimal:
+		return "DECIMAL"
+	case KindDate:
+		return "DATE"
+	case KindTime:
+		return "TIME"
+	case KindTimestamp:
+		return "TIMESTAMP"
+	case KindBlob:
+		return "BLOB"
+	}
+	return "NULL"
+}
+
+// Value est une valeur SQL typée. La Value zéro est NULL.
+type Value struct {
+	kind  Kind
+	i     int64 // KindInt, KindBool (0 ou 1), KindDecimal (sans échelle), dates et heures (voir datetime.go)
+	f     float64
+	s     string // KindText, KindBlob (octets bruts)
+	scale uint8  // KindDecimal
+}
+
+func Null() Value             { return Value{} }
+func Int(i int64) Value       { return Value{kind: KindInt, i: i} }
+func Float(f float64) Value   { return Value{kind: KindFloat, f: f} }
+func Text(s string) Value     { return Value{kind: KindText, s: s} }
+func Bool(b bool) Value       { return Value{kind: KindBool, i: boolInt(b)} }
+func Blob(b []byte) Value     { return Value{kind: KindBlob, s: string(b)} }
+func (v Value) Kind() Kind    { return v.kind }
+func (v Value) Bytes() []byte { return []byte(v.s) }
+func (v Value) IsNull() bool  { return v.kind == KindNull }
+func (v Value) Int() int64    { return v.i }
+func (v Value) Bool() bool    { return v.i != 0 }
+func (v Value) IsNumber() bool {
+	return v.kind == KindInt || v.kind == KindFloat || v.kind == KindDecimal
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Float renvoie la valeur d’un nombre sous forme de float64.
+func (v Value) Float() float64 {
+	switch v.kind {
+	case KindInt:
+		return float64(v.i)
+	case KindDecimal:
+		f, _ := v.Rat().Float64()
+		return f
+	}
+	return v.f
+}
+
+// String renvoie le texte d’une valeur tel qu’affiché dans les résultats.
+func (v Value) String() string {
+	switch v.kind {
+	case KindInt:
+		return strconv.FormatInt(v.i, 10)
+	case KindFloat:
+		return formatFloat(v.f)
+	case KindDecimal:
+		return decimalString(v.i, int(v.scale))
+	case KindText:
+		return v.s
+	case KindBool:
+		if v.i != 0 {
+			return "TRUE"
+		}
+		return "FALSE"
+	case KindDate, KindTime, KindTimestamp:
+		return formatTemporal(v)
+	case KindBlob:
+		return "X'" + strings.ToUpper(hex.EncodeToString([]byte(v.s))) + "'"
+	}
+	return "NULL"
+}
+
+// formatFloat écrit un flottant de sorte qu’il se lise comme tel : 3
+// s’affiche 3.0.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if math.Abs(f) < 1e15 {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// Compare ordonne deux valeurs : les nombres par valeur, les textes dans
+// l’ordre lexicographique, FALSE avant TRUE, les dates et heures dans
+// l’ordre chronologique. ok vaut false si l’une des valeurs est NULL ou si
+// leurs types ne se comparent pas.
+func Compare(a, b Value) (cmp int, ok bool) {
+	switch {
+	case a.kind == KindNull || b.kind == KindNull:
+		return 0, false
+	case a.kind == KindInt && b.kind == KindInt:
+		return cmpOrdered(a.i, b.i), true
+	case a.IsNumber() && b.IsNumber():
+		if a.kind == KindDecimal || b.kind == KindDecimal {
+			// exactement, un FLOAT étant lu comme sa plus courte forme décimale
+			return a.Rat().Cmp(b.Rat()), true
+		}
+		return cmpOrdered(a.Float(), b.Float()), true
+	case a.kind == KindText && b.kind == KindText, a.kind == KindBlob && b.kind == KindBlob:
+		return strings.Compare(a.s, b.s), true
+	case a.kind == KindBool && b.kind == KindBool:
+		return cmpOrdered(a.i, b.i), true
+	case a.kind == KindTime && b.kind == KindTime:
+		return cmpOrdered(a.i, b.i), true
+	case a.kind != KindTime && b.kind != KindTime && a.IsTemporal() && b.IsTemporal():
+		// une DATE vaut minuit de son jour
+		return cmpOrdered(a.timestampMicros(), b.timestampMicros()), true
+	}
+	return 0, false
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Equal indique si deux valeurs non NULL sont égales.
+func Equal(a, b Value) bool {
+	cmp, ok := Compare(a, b)
+	return ok && cmp == 0
+}
+
+// Row associe les noms de colonnes aux valeurs. Une colonne NULL est
+// absente de la ligne.
+type Row map[string]Value
+
+// Clone renvoie une copie de la ligne.
+func (r Row) Clone() Row {
+	c := make(Row, len(r))
+	for k, v := range r {
+		c[k] = v
+	}
+	return c
+}
+
+// Coerce convertit une valeur dans le type de la colonne. NULL reste NULL ;
+// les textes contenant une valeur du type de la colonne sont acceptés, les
+// nombres se convertissent entre eux sans perte de chiffre (un DECIMAL est
+// arrondi à son échelle), les dates et heures sont lues depuis des textes
+// ISO-8601, les blobs prennent les octets d’un texte, et les colonnes
+// texte acceptent toute valeur sauf un blob.
+func (c Column) Coerce(v Value) (Value, error) {
+	if v.IsNull() {
+		return v, nil
+	}
+
+	switch c.Type {
+	case TypeInt:
+		switch v.kind {
+		case KindInt:
+			return v, nil
+		case KindFloat, KindDecimal:
+			if r := v.Rat(); r.IsInt() && r.Num().IsInt64() {
+				return Int(r.Num().Int64()), nil
+			}
+		case KindText:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v.s), 10, 64); err == nil {
+				return Int(i), nil
+			}
+			if r, ok := new(big.Rat).SetString(strings.TrimSpace(v.s)); ok && r.IsInt() && r.Num().IsInt64() {
+				return Int(r.Num().Int64()), nil
+			}
+		}
+
+	case TypeReal:
+		switch v.kind {
+		case KindFloat:
+			return v, nil
+		case KindInt, KindDecimal:
+			return Float(v.Float()), nil
+		case KindText:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v.s), 64); err == nil {
+				return Float(f), nil
+			}
+		}
+
+	case TypeDecimal:
+		switch v.kind {
+		case KindInt, KindFloat, KindDecimal:
+			return DecimalFromRat(v.Rat(), c.Precision, c.Scale)
+		case KindText:
+			if r, ok := new(big.Rat).SetString(strings.TrimSpace(v.s)); ok {
+				return DecimalFromRat(r, c.Precision, c.Scale)
+			}
+		}
+
+	case TypeBool:
+		switch v.kind {
+		case KindBool:
+			return v, nil
+		case KindInt:
+			if v.i == 0 || v.i == 1 {
+				return Bool(v.i == 1), nil
+			}
+		case KindText:
+			if b, ok := ParseBool(v.s); ok {
+				return Bool(b), nil
+			}
+		}
+
+	case TypeDate, TypeTime, TypeTimestamp:
+		if t, ok := coerceTemporal(v, temporalKinds[c.Type]); ok {
+			return t, nil
+		}
+
+	case TypeBlob:
+		switch v.kind {
+		case KindBlob:
+			return v, nil
+		case KindText:
+			return Blob([]byte(v.s)), nil
+		}
+
+	case TypeString:
+		if v.kind == KindText {
+			return v, nil
+		}
+		if v.kind != KindBlob {
+			return Text(v.String()), nil
+		}
+	}
+	return Value{}, c.mismatch(v)
+}
+
+var temporalKinds = map[ColType]Kind{
+	TypeDate:      KindDate,
+	TypeTime:      KindTime,
+	TypeTimestamp: KindTimestamp,
+}
+
+// ParseBool lit le texte d’un booléen : TRUE/FALSE, T/F, YES/NO, ON/OFF ou
+// 1/0, sans tenir compte de la casse.
+func ParseBool(s string) (b, ok bool) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "TRUE", "T", "YES", "Y", "ON", "1":
+		return true, true
+	case "FALSE", "F", "NO", "N", "OFF", "0":
+		return false, true
+	}
+	return false, false
+}
+
+func (c Column) mismatch(v Value) error {
+	if v.kind == KindText {
+		return fmt.Errorf("column '%s' expects %s, got %s '%s'", c.Name, c.TypeName(), v.kind, v.s)
+	}
+	return fmt.Errorf("column '%s' expects %s, got %s %s", c.Name, c.TypeName(), v.kind, v)
+}
+
+// coerceRow convertit dans les types des colonnes les valeurs d’une ligne
+// lue depuis un fichier ou un journal plus ancien ; les valeurs qui ne se
+// convertissent pas sont conservées telles quelles.
+func coerceRow(s Schema, row Row) Row {
+	cols := s.ColumnsMap()
+	for name, v := range row {
+		if col, ok := cols[name]; ok {
+			if c, err := col.Coerce(v); err == nil {
+				row[name] = c
+			}
+		}
+	}
+	return row
+}
+
+// Key renvoie la clé du B+ Tree d’une valeur de clé primaire.
+func (v Value) Key() string {
+	return v.String()
+}
+
+// uniqueKey renvoie une clé commune à toutes les valeurs égales au sens
+// de Equal, pour l’index des colonnes UNIQUE.
+func (v Value) uniqueKey() string {
+	switch {
+	case v.kind == KindFloat && (math.IsNaN(v.f) || math.IsInf(v.f, 0)):
+		return "f" + v.String()
+	case v.IsNumber():
+		return "n" + v.Rat().RatString()
+	case v.kind == KindDate || v.kind == KindTimestamp:
+		// une DATE vaut minuit de son jour
+		return "t" + strconv.FormatInt(v.timestampMicros(), 10)
+	}
+	return strconv.Itoa(int(v.kind)) + ":" + v.String()
+}
+
+// keyOrder renvoie l’ordre des clés du B+ Tree d’une table : les clés d’une
+// clé primaire numérique sont rangées par valeur (9 avant 10), les autres
+// dans l’ordre lexicographique, qui est aussi celui des dates et heures
+// ISO-8601. Une clé qui ne se lit pas comme un nombre, venue d’un fichier
+// ancien, est rangée après les nombres.
+func keyOrder(s Schema) func(a, b string) int {
+	for _, c := range s.Columns {
+		if !c.PrimaryKey {
+			continue
+		}
+		switch c.Type {
+		case TypeInt:
+			return numericOrder(func(k string) (int64, bool) {
+				i, err := strconv.ParseInt(k, 10, 64)
+				return i, err == nil
+			}, cmp.Compare[int64])
+		case TypeReal:
+			return numericOrder(func(k string) (float64, bool) {
+				f, err := strconv.ParseFloat(k, 64)
+				return f, err == nil
+			}, cmp.Compare[float64])
+		case TypeDecimal:
+			return numericOrder(func(k string) (*big.Rat, bool) {
+				return new(big.Rat).SetString(k)
+			}, (*big.Rat).Cmp)
+		}
+	}
+	return strings.Compare
+}
+
+// numericOrder range d’abord les clés que parse sait lire, par valeur, puis
+// les autres ; les égalités sont départagées par le texte des clés, pour
+// que seule une clé soit égale à elle-même.
+func numericOrder[T any](parse func(string) (T, bool), compare func(a, b T) int) func(a, b string) int {
+	return func(a, b string) int {
+		x, okA := parse(a)
+		y, okB := parse(b)
+		switch {
+		case okA && okB:
+			if c := compare(x, y); c != 0 {
+				return c
+			}
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return strings.Compare(a, b)
+	}
+}
@@ -0,0 +1,407 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walFileName est le nom du journal d’écriture anticipée d’un répertoire
+// de base.
+const walFileName = "wal.log"
+
+// walCheckpointSize est la taille du journal au-delà de laquelle un commit
+// déclenche un checkpoint.
+const walCheckpointSize = 4 << 20
+
+// walMaxRecord borne la longueur d’un enregistrement, de sorte qu’une
+// longueur corrompue est traitée comme la fin du journal.
+const walMaxRecord = 64 << 20
+
+type walOp byte
+
+const (
+	walPutText    walOp = iota + 1 // ligne écrite dans une table, valeurs texte seulement (anciens journaux)
+	walDelete                      // ligne supprimée d’une table
+	walCommit                      // fin d’un lot d’enregistrements put/delete
+	walPage                        // image d’une page d’un fichier de table
+	walCheckpoint                  // toutes les images de pages qui précèdent sont complètes
+	walPut                         // ligne écrite dans une table
+)
+
+type walRecord struct {
+	Op    walOp
+	Table string // nom de la table, ou du fichier de la table pour walPage
+	Key   string
+	Row   Row
+	Page  pageID
+	Data  []byte
+}
+
+// wal est le journal d’écriture anticipée d’un répertoire de base.
+//
+// Les modifications des tables sont ajoutées et synchronisées dans le
+// journal par lots d’enregistrements put/delete terminés par un
+// enregistrement commit ; les fichiers des tables ne sont pas touchés. Un
+// checkpoint reporte ensuite les modifications dans les fichiers des
+// tables : les images de toutes les pages sur le point d’être écrites sont
+// d’abord journalisées, suivies d’un enregistrement checkpoint, puis les
+// pages sont écrites et le journal est vidé.
+//
+// Après un arrêt brutal, la restauration réécrit les images de pages si
+// l’enregistrement checkpoint a atteint le journal (ce qui répare les
+// fichiers de tables déchirés), puis rejoue les lots validés journalisés
+// après lui. Les enregistrements non validés ou déchirés en fin de journal
+// sont ignorés.
+//
+// Chaque enregistrement est encadré ainsi : longueur uint32, CRC-32 du
+// contenu uint32, contenu.
+type wal struct {
+	file   *os.File
+	size   int64
+	tables map[string]*Table
+}
+
+// openTables charge les tables d’un répertoire de base et son journal
+// d’écriture anticipée, en restaurant la base après un arrêt brutal si le
+// journal n’est pas vide. Une table impossible à charger est une erreur :
+// le journal est alors laissé tel quel, car il peut contenir des
+// modifications validées de cette table.
+func openTables(dir string) (map[string]*Table, *wal, error) {
+	walPath := filepath.Join(dir, walFileName)
+	recs, valid, err := readWAL(walPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logical := recs
+	if last := lastCheckpoint(recs); last >= 0 {
+		if err := restorePages(dir, recs[:last]); err != nil {
+			return nil, nil, err
+		}
+		logical = recs[last+1:]
+	}
+
+	tables := make(map[string]*Table)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".tbl" {
+			t, err := LoadTable(filepath.Join(dir, f.Name()))
+			if err != nil {
+				closeAll(tables)
+				return nil, nil, fmt.Errorf("cannot load table %s: %w", f.Name(), err)
+			}
+			tables[t.Name] = t
+		}
+	}
+
+	w, err := openWAL(walPath, valid, tables)
+	if err != nil {
+		closeAll(tables)
+		return nil, nil, err
+	}
+	for _, t := range tables {
+		t.wal = w
+	}
+
+	if len(recs) > 0 {
+		replay(tables, logical)
+		if err := w.checkpoint(); err != nil {
+			w.close()
+			closeAll(tables)
+			return nil, nil, fmt.Errorf("recovery of %s failed: %w", dir, err)
+		}
+	}
+	return tables, w, nil
+}
+
+func openWAL(path string, size int64, tables map[string]*Table) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Supprime un enregistrement déchiré laissé en fin de journal.
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &wal{file: f, size: size, tables: tables}, nil
+}
+
+// readWAL renvoie les enregistrements intacts du journal path et la
+// longueur du journal qu’ils occupent.
+func readWAL(path string) ([]walRecord, int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var recs []walRecord
+	var valid int64
+	r := bufio.NewReader(f)
+	var frame [8]byte
+	for {
+		if _, err := io.ReadFull(r, frame[:]); err != nil {
+			break
+		}
+		length := binary.LittleEndian.Uint32(frame[:])
+		if length > walMaxRecord {
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(frame[4:]) {
+			break
+		}
+		rec, err := decodeWALRecord(payload)
+		if err != nil {
+			break
+		}
+		recs = append(recs, rec)
+		valid += int64(len(frame)) + int64(length)
+	}
+	return recs, valid, nil
+}
+
+func lastCheckpoint(recs []walRecord) int {
+	for i := len(recs) - 1; i >= 0; i-- {
+		if recs[i].Op == walCheckpoint {
+			return i
+		}
+	}
+	return -1
+}
+
+// restorePages écrit les images de pages journalisées dans les fichiers
+// des tables.
+func restorePages(dir string, recs []walRecord) error {
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, rec := range recs {
+		if rec.Op != walPage {
+			continue
+		}
+		f, ok := files[rec.Table]
+		if !ok {
+			var err error
+			f, err = os.OpenFile(filepath.Join(dir, rec.Table), os.O_RDWR, 0o644)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			files[rec.Table] = f
+		}
+		if _, err := f.WriteAt(rec.Data, int64(rec.Page)*PageSize); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replay applique les lots validés aux tables.
+func replay(tables map[string]*Table, recs []walRecord) {
+	var batch []walRecord
+	for _, rec := range recs {
+		switch rec.Op {
+		case walPut, walPutText, walDelete:
+			batch = append(batch, rec)
+		case walCommit:
+			for _, r := range batch {
+				t, ok := tables[r.Table]
+				if !ok {
+					continue
+				}
+				switch r.Op {
+				case walPutText:
+					t.putRow(r.Key, coerceRow(t.Schema, r.Row))
+				case walPut:
+					t.putRow(r.Key, r.Row)
+				default:
+					t.deleteRow(r.Key)
+				}
+			}
+			batch = nil
+		}
+	}
+}
+
+// commit ajoute durablement un lot de modifications suivi d’un
+// enregistrement commit.
+func (w *wal) commit(recs []walRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	return w.append(append(recs, walRecord{Op: walCommit})...)
+}
+
+// checkpointIfFull effectue un checkpoint lorsque le journal est devenu
+// trop gros. Elle ne doit s’exécuter qu’une fois les modifications validées
+// appliquées aux tables.
+func (w *wal) checkpointIfFull() error {
+	if w.size >= walCheckpointSize {
+		return w.checkpoint()
+	}
+	return nil
+}
+
+func (w *wal) append(recs ...walRecord) error {
+	var buf []byte
+	for _, rec := range recs {
+		payload := encodeWALRecord(rec)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+		buf = append(buf, payload...)
+	}
+
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+// checkpoint écrit les modifications de chaque table dans son fichier et
+// vide le journal.
+func (w *wal) checkpoint() error {
+	names := make([]string, 0, len(w.tables))
+	for name := range w.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var images []walRecord
+	for _, name := range names {
+		t := w.tables[name]
+		pages, err := t.Index.stagedPages()
+		if err != nil {
+			return err
+		}
+		ids := make([]pageID, 0, len(pages))
+		for id := range pages {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		file := filepath.Base(t.FilePath)
+		for _, id := range ids {
+			images = append(images, walRecord{Op: walPage, Table: file, Page: id, Data: pages[id]})
+		}
+	}
+
+	if len(images) > 0 {
+		if err := w.append(append(images, walRecord{Op: walCheckpoint})...); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := w.tables[name].Index.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.size == 0 {
+		return nil
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+func encodeWALRecord(rec walRecord) []byte {
+	buf := []byte{byte(rec.Op)}
+	switch rec.Op {
+	case walPut:
+		buf = appendString(buf, rec.Table)
+		buf = appendString(buf, rec.Key)
+		buf = encodeRow(buf, rec.Row)
+	case walDelete:
+		buf = appendString(buf, rec.Table)
+		buf = appendString(buf, rec.Key)
+	case walPage:
+		buf = appendString(buf, rec.Table)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(rec.Page))
+		buf = append(buf, rec.Data...)
+	}
+	return buf
+}
+
+var errBadRecord = errors.New("invalid log record")
+
+func decodeWALRecord(payload []byte) (walRecord, error) {
+	d := decoder{data: payload}
+	rec := walRecord{Op: walOp(d.byte())}
+	switch rec.Op {
+	case walPut, walPutText:
+		rec.Table = d.string()
+		rec.Key = d.string()
+		format := uint32(rowFormat)
+		if rec.Op == walPutText {
+			format = 0
+		}
+		rec.Row = decodeRow(&d, format)
+	case walDelete:
+		rec.Table = d.string()
+		rec.Key = d.string()
+	case walPage:
+		rec.Table = d.string()
+		rec.Page = pageID(d.uint32())
+		rec.Data = d.take(PageSize)
+	case walCommit, walCheckpoint:
+	default:
+		return rec, errBadRecord
+	}
+	if d.err != nil {
+		return rec, d.err
+	}
+	return rec, nil
+}
+
+func closeAll(tables map[string]*Table) {
+	for _, t := range tables {
+		t.Close()
+	}
+}
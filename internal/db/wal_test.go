@@ -0,0 +1,218 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// crashCopy copie les fichiers d’une base ouverte, comme les laisserait un
+// arrêt brutal : les modifications non reportées n’existent que dans le
+// journal.
+func crashCopy(t *testing.T, src string) string {
+	t.Helper()
+	dst := t.TempDir()
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dst
+}
+
+// recoverKeys ouvre une copie de base et renvoie les clés de la table users.
+func recoverKeys(t *testing.T, dir string) []string {
+	t.Helper()
+	tables, w, err := openTables(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAll(tables)
+	defer w.close()
+	if w.size != 0 {
+		t.Fatalf("log holds %d bytes after recovery, want 0", w.size)
+	}
+	return tables["users"].Index.Keys()
+}
+
+func activeDir(t *testing.T, d *Database) string {
+	t.Helper()
+	dir, err := d.ActivePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRecoveryReplaysCommittedBatches(t *testing.T) {
+	d, tbl := openTestDB(t)
+	for i := int64(1); i <= 3; i++ {
+		insert(t, d, tbl, Row{"id": Int(i), "email": Text("e" + strconv.FormatInt(i, 10))})
+	}
+	if _, err := tbl.Delete("id", Int(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Un lot sans enregistrement commit n’est pas rejoué.
+	if err := tbl.wal.append(walRecord{Op: walPut, Table: "users", Key: "9", Row: Row{"id": Int(9)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := crashCopy(t, activeDir(t, d))
+	if got, want := recoverKeys(t, dir), []string{"1", "3"}; !slices.Equal(got, want) {
+		t.Fatalf("recovered keys %v, want %v", got, want)
+	}
+	// La restauration a reporté les lignes dans le fichier de la table.
+	if got, want := recoverKeys(t, dir), []string{"1", "3"}; !slices.Equal(got, want) {
+		t.Fatalf("keys after a second open %v, want %v", got, want)
+	}
+
+	// L’index des colonnes UNIQUE suit les lignes rejouées.
+	tables, w, err := openTables(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAll(tables)
+	defer w.close()
+	if key, ok := tables["users"].lookupUnique("email", Text("e3")); !ok || key != "3" {
+		t.Fatalf("lookupUnique(e3) = %q, %v", key, ok)
+	}
+	if _, ok := tables["users"].lookupUnique("email", Text("e2")); ok {
+		t.Fatal("the value of a deleted row is still indexed")
+	}
+}
+
+func TestRecoveryTruncatesTornTail(t *testing.T) {
+	d, tbl := openTestDB(t)
+	dir := activeDir(t, d)
+
+	// Taille du journal après chaque commit.
+	var ends []int64
+	for i := int64(1); i <= 4; i++ {
+		insert(t, d, tbl, Row{"id": Int(i), "name": Text(strings.Repeat("x", int(i)*10))})
+		ends = append(ends, tbl.wal.size)
+	}
+	log, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(log)) != ends[len(ends)-1] {
+		t.Fatalf("log holds %d bytes, want %d", len(log), ends[len(ends)-1])
+	}
+
+	for cut := 0; cut <= len(log); cut++ {
+		copyDir := crashCopy(t, dir)
+		if err := os.WriteFile(filepath.Join(copyDir, walFileName), log[:cut], 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var want []string
+		for i, end := range ends {
+			if int64(cut) >= end {
+				want = append(want, strconv.Itoa(i+1))
+			}
+		}
+		if got := recoverKeys(t, copyDir); !slices.Equal(got, want) {
+			t.Fatalf("log cut at %d bytes: recovered keys %v, want %v", cut, got, want)
+		}
+	}
+
+	// Un enregistrement dont la somme de contrôle est fausse termine le
+	// journal.
+	bad := bytes.Clone(log)
+	bad[ends[1]+10] ^= 0xFF
+	copyDir := crashCopy(t, dir)
+	if err := os.WriteFile(filepath.Join(copyDir, walFileName), bad, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := recoverKeys(t, copyDir), []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Fatalf("corrupted log: recovered keys %v, want %v", got, want)
+	}
+}
+
+func TestRecoveryRestoresPagesAfterCheckpoint(t *testing.T) {
+	d, tbl := openTestDB(t)
+	for i := int64(1); i <= 200; i++ {
+		insert(t, d, tbl, Row{"id": Int(i), "name": Text(strings.Repeat("n", 40))})
+	}
+
+	// Checkpoint interrompu : les images de pages et l’enregistrement
+	// checkpoint ont atteint le journal, pas le fichier de la table.
+	pages, err := tbl.Index.stagedPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Base(tbl.FilePath)
+	var images []walRecord
+	for id, data := range pages {
+		images = append(images, walRecord{Op: walPage, Table: file, Page: id, Data: data})
+	}
+	if err := tbl.wal.append(append(images, walRecord{Op: walCheckpoint})...); err != nil {
+		t.Fatal(err)
+	}
+	// Un commit après le checkpoint est rejoué par-dessus les pages.
+	insert(t, d, tbl, Row{"id": Int(201)})
+
+	dir := crashCopy(t, activeDir(t, d))
+
+	// Les pages en cours d’écriture sont déchirées.
+	f, err := os.OpenFile(filepath.Join(dir, file), os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range pages {
+		if _, err := f.WriteAt(bytes.Repeat([]byte{0xAB}, PageSize/2), int64(id)*PageSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	keys := recoverKeys(t, dir)
+	if len(keys) != 201 || keys[0] != "1" || keys[200] != "201" {
+		t.Fatalf("recovered %d keys from %v to %v, want 1 to 201", len(keys), keys[0], keys[len(keys)-1])
+	}
+}
+
+func TestRecoveryFailsOnUnloadableTable(t *testing.T) {
+	d, tbl := openTestDB(t)
+	insert(t, d, tbl, Row{"id": Int(1)})
+	dir := crashCopy(t, activeDir(t, d))
+
+	// Le fichier de la table est illisible.
+	if err := os.WriteFile(filepath.Join(dir, "users.tbl"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := openTables(dir); err == nil || !strings.Contains(err.Error(), "cannot load table users.tbl") {
+		t.Fatalf("openTables = %v, want a load error", err)
+	}
+	// Le journal, qui contient encore la ligne validée, est intact.
+	after, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil || !bytes.Equal(after, log) {
+		t.Fatalf("log changed by the failed recovery (%d bytes, was %d): %v", len(after), len(log), err)
+	}
+
+	root := t.TempDir()
+	if err := os.Rename(dir, filepath.Join(root, "broken")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDatabase(root); err == nil {
+		t.Fatal("NewDatabase succeeded with a database it cannot recover")
+	}
+}
@@ -0,0 +1,385 @@
+package sql
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// aggregate is an aggregate function: it folds the values of its first
+// argument over the rows of a group. Other arguments are constants, whose
+// values new is given.
+type aggregate struct {
+	minArgs, maxArgs int
+	star             bool // accepts * as its argument
+	new              func(call *AggregateCall, consts []db.Value) (accumulator, error)
+}
+
+// accumulator computes an aggregate function over the rows of one group.
+type accumulator interface {
+	add(v db.Value) error
+	result() (db.Value, error)
+}
+
+var aggregates = map[string]aggregate{
+	"COUNT":        {1, 1, true, newCount},
+	"SUM":          {1, 1, false, newSum},
+	"AVG":          {1, 1, false, newSum},
+	"MIN":          {1, 1, false, newExtreme(-1)},
+	"MAX":          {1, 1, false, newExtreme(1)},
+	"GROUP_CONCAT": {1, 2, false, newConcat},
+	"STRING_AGG":   {2, 2, false, newConcat},
+}
+
+// aggregateCall reads "name(*)" or "name([DISTINCT] arg, ...)".
+func (p *parser) aggregateCall() (Expr, error) {
+	name := p.next()
+	p.next() // (
+
+	call := &AggregateCall{Name: name.keyword(), Pos: name.Pos}
+	agg := aggregates[call.Name]
+	if star := p.peek(); p.acceptSymbol("*") {
+		if !agg.star {
+			return nil, syntaxError(star.Pos, fmt.Sprintf("%s requires an argument, not *", call.Name))
+		}
+		call.Star = true
+		if _, err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return p.over(call)
+	}
+
+	call.Distinct = p.acceptKeyword("DISTINCT")
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if _, err := p.over(call); err != nil {
+		return nil, err
+	}
+
+	if n := len(call.Args); n < agg.minArgs || n > agg.maxArgs {
+		return nil, syntaxError(name.Pos, fmt.Sprintf("%s takes %s", call.Name, arity(agg.minArgs, agg.maxArgs)))
+	}
+	for _, arg := range call.Args {
+		// Over a window, an argument may use the aggregates of a group
+		check := noAggregate
+		if call.Over != nil {
+			check = noWindow
+		}
+		if err := check(arg, "the argument of "+call.Name); err != nil {
+			return nil, err
+		}
+	}
+	for _, arg := range call.Args[1:] {
+		var err error
+		walk(arg, func(e Expr) {
+			if ref, ok := e.(*ColumnRef); ok && err == nil {
+				err = syntaxError(ref.Pos, fmt.Sprintf("only the first argument of %s may use columns", call.Name))
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return call, nil
+}
+
+// over reads the window of call after "OVER", if any, which makes it a
+// window function.
+func (p *parser) over(call *AggregateCall) (Expr, error) {
+	if !p.acceptKeyword("OVER") {
+		return call, nil
+	}
+	var err error
+	call.Over, err = p.window()
+	return call, err
+}
+
+// noAggregate reports an aggregate or window function used in a clause
+// evaluated row by row.
+func noAggregate(e Expr, clause string) error {
+	var err error
+	walk(e, func(e Expr) {
+		if err != nil {
+			return
+		}
+		if windowOf(e) != nil {
+			err = noWindow(e, clause)
+		} else if call, ok := e.(*AggregateCall); ok {
+			err = syntaxError(call.Pos, fmt.Sprintf("aggregate function %s is not allowed in %s", call.Name, clause))
+		}
+	})
+	return err
+}
+
+// aggregateCalls returns the aggregate function calls made by exprs, but
+// not those over a window.
+func aggregateCalls(exprs []Expr) []*AggregateCall {
+	var calls []*AggregateCall
+	for _, e := range exprs {
+		walk(e, func(e Expr) {
+			if call, ok := e.(*AggregateCall); ok && call.Over == nil {
+				calls = append(calls, call)
+			}
+		})
+	}
+	return calls
+}
+
+// groupRows splits rows, each joining a row of every table of sc, into
+// groups having the same values of the keys, in the order their first row
+// comes. Without keys, all rows make one group, even when there are none.
+func groupRows(keys []Expr, sc *scope, rows [][]db.Row) ([][][]db.Row, error) {
+	if len(keys) == 0 {
+		return [][][]db.Row{rows}, nil
+	}
+
+	var groups [][][]db.Row
+	index := make(map[string]int)
+	for _, row := range rows {
+		sc.bind(row...)
+		var id strings.Builder
+		for _, key := range keys {
+			v, err := evalValue(key, sc)
+			if err != nil {
+				return nil, err
+			}
+			id.WriteString(groupKey(v))
+			id.WriteByte(0)
+		}
+		i, ok := index[id.String()]
+		if !ok {
+			i = len(groups)
+			index[id.String()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], row)
+	}
+	return groups, nil
+}
+
+// groupKey returns a text that is the same for values grouped together:
+// NULLs make one group, and numbers equal in value another.
+func groupKey(v db.Value) string {
+	if v.IsNumber() {
+		return "N" + v.Rat().RatString()
+	}
+	return v.Kind().String() + ":" + v.String()
+}
+
+// computeAggregates returns the value of each call over the rows of a
+// group, evaluated against the tables of sc.
+func computeAggregates(calls []*AggregateCall, sc *scope, rows [][]db.Row) (map[*AggregateCall]db.Value, error) {
+	values := make(map[*AggregateCall]db.Value, len(calls))
+	for _, call := range calls {
+		acc, err := newAccumulator(call, sc)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			// COUNT(*) counts rows, whatever their values
+			v := db.Int(1)
+			if !call.Star {
+				sc.bind(row...)
+				if v, err = evalValue(call.Args[0], sc); err != nil {
+					return nil, err
+				}
+			}
+			if err := acc.add(v); err != nil {
+				return nil, err
+			}
+		}
+		if values[call], err = acc.result(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// newAccumulator returns an accumulator for call, whose constant arguments
+// are evaluated against sc.
+func newAccumulator(call *AggregateCall, sc *scope) (accumulator, error) {
+	var consts []db.Value
+	for _, arg := range call.Args[min(1, len(call.Args)):] {
+		v, err := evalValue(arg, sc)
+		if err != nil {
+			return nil, err
+		}
+		consts = append(consts, v)
+	}
+	acc, err := aggregates[call.Name].new(call, consts)
+	if err != nil {
+		return nil, err
+	}
+	if call.Distinct {
+		acc = &distinctAcc{acc: acc, seen: make(map[string]bool)}
+	}
+	return acc, nil
+}
+
+// distinctAcc passes each distinct value once to acc.
+type distinctAcc struct {
+	acc  accumulator
+	seen map[string]bool
+}
+
+func (a *distinctAcc) add(v db.Value) error {
+	key := groupKey(v)
+	if a.seen[key] {
+		return nil
+	}
+	a.seen[key] = true
+	return a.acc.add(v)
+}
+
+func (a *distinctAcc) result() (db.Value, error) {
+	return a.acc.result()
+}
+
+// countAcc computes COUNT, the number of values that are not NULL.
+type countAcc struct {
+	n int64
+}
+
+func newCount(*AggregateCall, []db.Value) (accumulator, error) { return &countAcc{}, nil }
+
+func (a *countAcc) add(v db.Value) error {
+	if !v.IsNull() {
+		a.n++
+	}
+	return nil
+}
+
+func (a *countAcc) result() (db.Value, error) {
+	return db.Int(a.n), nil
+}
+
+// sumAcc computes SUM and AVG, skipping NULL values. The sum is exact: it
+// is an INT for integers, a DECIMAL with the largest scale of the values
+// when one is a DECIMAL, and a FLOAT when one is a FLOAT. AVG is a FLOAT,
+// or a DECIMAL with 4 more digits for DECIMAL values.
+type sumAcc struct {
+	call         *AggregateCall
+	sum          *big.Rat
+	count        int64
+	float, exact bool // a FLOAT, a DECIMAL was added
+	scale        int
+}
+
+func newSum(call *AggregateCall, _ []db.Value) (accumulator, error) {
+	return &sumAcc{call: call, sum: new(big.Rat)}, nil
+}
+
+func (a *sumAcc) add(v db.Value) error {
+	if v.IsNull() {
+		return nil
+	}
+	n, err := numericOperand(v, a.call.Args[0])
+	if err != nil {
+		return fmt.Errorf("%s: cannot %s non-numeric value %s", a.call.Pos, a.call.Name, v)
+	}
+	switch n.Kind() {
+	case db.KindFloat:
+		a.float = true
+	case db.KindDecimal:
+		a.exact = true
+		a.scale = max(a.scale, n.Scale())
+	}
+	a.sum.Add(a.sum, n.Rat())
+	a.count++
+	return nil
+}
+
+func (a *sumAcc) result() (db.Value, error) {
+	if a.count == 0 {
+		return db.Null(), nil
+	}
+	if a.call.Name == "AVG" {
+		avg := new(big.Rat).Quo(a.sum, new(big.Rat).SetInt64(a.count))
+		if a.exact && !a.float {
+			return decimalResult(avg, a.scale+4, a.call.Pos)
+		}
+		f, _ := avg.Float64()
+		return db.Float(f), nil
+	}
+
+	switch {
+	case a.float:
+		f, _ := a.sum.Float64()
+		return db.Float(f), nil
+	case a.exact:
+		return decimalResult(a.sum, a.scale, a.call.Pos)
+	case !a.sum.Num().IsInt64():
+		return db.Value{}, fmt.Errorf("%s: integer overflow", a.call.Pos)
+	}
+	return db.Int(a.sum.Num().Int64()), nil
+}
+
+// extremeAcc computes MIN (sign -1) and MAX (sign 1), skipping NULL
+// values. Values are ordered as by ORDER BY.
+type extremeAcc struct {
+	sign int
+	best db.Value
+}
+
+func newExtreme(sign int) func(*AggregateCall, []db.Value) (accumulator, error) {
+	return func(*AggregateCall, []db.Value) (accumulator, error) {
+		return &extremeAcc{sign: sign}, nil
+	}
+}
+
+func (a *extremeAcc) add(v db.Value) error {
+	if !v.IsNull() && (a.best.IsNull() || compareForSort(v, a.best)*a.sign > 0) {
+		a.best = v
+	}
+	return nil
+}
+
+func (a *extremeAcc) result() (db.Value, error) {
+	return a.best, nil
+}
+
+// concatAcc computes GROUP_CONCAT and STRING_AGG: the texts of the values
+// that are not NULL, joined by a separator (a comma by default; NULL joins
+// them with nothing).
+type concatAcc struct {
+	sep    string
+	values []string
+}
+
+func newConcat(_ *AggregateCall, consts []db.Value) (accumulator, error) {
+	acc := &concatAcc{sep: ","}
+	if len(consts) > 0 {
+		acc.sep = ""
+		if !consts[0].IsNull() {
+			acc.sep = concatText(consts[0])
+		}
+	}
+	return acc, nil
+}
+
+func (a *concatAcc) add(v db.Value) error {
+	if !v.IsNull() {
+		a.values = append(a.values, concatText(v))
+	}
+	return nil
+}
+
+func (a *concatAcc) result() (db.Value, error) {
+	if len(a.values) == 0 {
+		return db.Null(), nil
+	}
+	return db.Text(strings.Join(a.values, a.sep)), nil
+}
@@ -0,0 +1,39 @@
+package sql
+
+import "testing"
+
+func TestGroupBy(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	exec(t, d, "INSERT INTO users (id, name, city, age) VALUES (5, 'eve', 'Lyon', 35)")
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT city, COUNT(*) FROM users GROUP BY city ORDER BY city", want: []string{"NULL|1", "Lyon|2", "Paris|2"}},
+		{query: "SELECT city, SUM(age), AVG(age) FROM users WHERE city IS NOT NULL GROUP BY city ORDER BY city", want: []string{"Lyon|60|30.0", "Paris|30|30.0"}},
+		{query: "SELECT city, COUNT(*) FROM users GROUP BY city HAVING COUNT(*) > 1 ORDER BY city", want: []string{"Lyon|2", "Paris|2"}},
+		{query: "SELECT city FROM users GROUP BY city HAVING SUM(age) > 50", want: []string{"Lyon"}},
+		{query: "SELECT age > 30, COUNT(*) FROM users WHERE age IS NOT NULL GROUP BY age > 30 ORDER BY 1", want: []string{"FALSE|2", "TRUE|2"}},
+		{query: "SELECT city, age, COUNT(*) FROM users WHERE id < 3 GROUP BY city, age ORDER BY city", want: []string{"Lyon|25|1", "Paris|30|1"}},
+		{query: "SELECT COUNT(*) * 10 + 1 FROM users", want: []string{"51"}},
+		{query: "SELECT COUNT(*) FROM users WHERE id > 10", want: []string{"0"}},
+		{query: "SELECT city, COUNT(*) FROM users WHERE id > 10 GROUP BY city", want: nil},
+		{query: "SELECT name, COUNT(*) FROM users GROUP BY city", err: "name"},
+		{query: "SELECT id FROM users WHERE COUNT(*) > 1", err: "WHERE"},
+	})
+}
+
+func TestAggregates(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	exec(t, d, "INSERT INTO users (id, name, city, age) VALUES (5, 'eve', 'Lyon', 30)")
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT COUNT(*), COUNT(age), COUNT(city), COUNT(DISTINCT age), COUNT(DISTINCT city) FROM users", want: []string{"5|4|4|3|2"}},
+		{query: "SELECT MIN(age), MAX(age), MIN(name), MAX(name), SUM(DISTINCT age) FROM users", want: []string{"25|41|ann|eve|96"}},
+		{query: "SELECT MIN(age), MAX(age), SUM(age), COUNT(age) FROM users WHERE id > 10", want: []string{"NULL|NULL|NULL|0"}},
+		{query: "SELECT city, GROUP_CONCAT(name) FROM users WHERE city IS NOT NULL GROUP BY city ORDER BY city", want: []string{"Lyon|bob,eve", "Paris|ann,cat"}},
+		{query: "SELECT STRING_AGG(name, ' ') FROM users WHERE age IS NOT NULL", want: []string{"ann bob dan eve"}},
+		{query: "SELECT GROUP_CONCAT(city, '/') FROM users", want: []string{"Paris/Lyon/Paris/Lyon"}},
+		{query: "SELECT MAX(age) - MIN(age) AS spread FROM users", want: []string{"16"}},
+		{query: "SELECT STRING_AGG(name) FROM users", err: "STRING_AGG"},
+		{query: "SELECT MIN(*) FROM users", err: "MIN"},
+		{query: "SELECT COUNT(DISTINCT *) FROM users", err: `expected a value, found "*"`},
+		{query: "SELECT MAX(MIN(age)) FROM users", err: "MAX"},
+	})
+}
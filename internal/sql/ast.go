@@ -0,0 +1,446 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in the query text. Lines and columns start at 1.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Col)
+}
+
+// Expr is a node of an expression tree.
+type Expr interface {
+	Position() Pos
+}
+
+type LiteralKind int
+
+const (
+	LitString LiteralKind = iota
+	LitNumber
+	LitNull
+	LitBool
+	LitBlob
+)
+
+// Literal is a constant value written in the query.
+type Literal struct {
+	Kind  LiteralKind
+	Value string // unquoted text; TRUE or FALSE for LitBool; hex digits for LitBlob
+	Pos   Pos
+}
+
+// ColumnRef names a column of the row being evaluated. Table is the name
+// or alias of its table when the column is qualified (u.name).
+type ColumnRef struct {
+	Table string
+	Name  string
+	Pos   Pos
+}
+
+// BinaryExpr applies an operator to two operands. Op is upper-cased:
+// "=", "<>", "<", "<=", ">", ">=", "LIKE", "AND", "OR", one of the
+// arithmetic operators "+", "-", "*", "/" and "%", or "||".
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+	Pos   Pos // position of the operator
+}
+
+// UnaryExpr applies an operator to one operand. Op is "NOT" or "-".
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+	Pos     Pos
+}
+
+// InExpr is "expr [NOT] IN (value, ...)" or "expr [NOT] IN (SELECT ...)".
+type InExpr struct {
+	Expr  Expr
+	List  []Expr
+	Query *SubqueryExpr // nil for a list of values
+	Not   bool
+	Pos   Pos
+}
+
+// BetweenExpr is "expr [NOT] BETWEEN low AND high".
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+	Pos  Pos
+}
+
+// IsNullExpr is "expr IS [NOT] NULL".
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+	Pos  Pos
+}
+
+// FuncCall calls a scalar function (see functions.go). Name is upper-cased;
+// NOW, CURRENT_DATE and the like may be written without parentheses.
+type FuncCall struct {
+	Name string
+	Args []Expr
+	Pos  Pos
+}
+
+// AggregateCall calls an aggregate function (see aggregate.go) over the
+// rows of a group, or over a window of rows when Over is set. Name is
+// upper-cased; Args is empty for "name(*)". With Distinct, equal values of
+// the first argument count once.
+type AggregateCall struct {
+	Name     string
+	Args     []Expr
+	Star     bool
+	Distinct bool
+	Over     *Window
+	Pos      Pos
+}
+
+// WindowCall calls a window function (see window.go) such as ROW_NUMBER,
+// which only exists over a window. Name is upper-cased.
+type WindowCall struct {
+	Name string
+	Args []Expr
+	Over *Window
+	Pos  Pos
+}
+
+// Window is "OVER ([PARTITION BY expr, ...] [ORDER BY expr [ASC|DESC], ...]
+// [frame])": the rows a window function sees from each row are those of
+// its partition, in order.
+type Window struct {
+	PartitionBy []Expr
+	OrderBy     []OrderBy
+	Frame       *Frame // nil for the default frame
+}
+
+// Frame is "ROWS BETWEEN start AND end", the rows of the partition an
+// aggregate function is computed over from each row.
+type Frame struct {
+	Start, End FrameBound
+}
+
+// FrameBound is a bound of a frame: Offset rows after the current row
+// (before it when negative), or the first (Offset -1) or last (Offset 1)
+// row of the partition when Unbounded.
+type FrameBound struct {
+	Offset    int
+	Unbounded bool
+}
+
+// SubqueryExpr is "(SELECT ...)" used as a value: that of the single
+// column of its single row, or NULL when it has no row.
+type SubqueryExpr struct {
+	Query *SelectStmt
+	Pos   Pos
+}
+
+// ExistsExpr is "EXISTS (SELECT ...)", true when the query has a row.
+type ExistsExpr struct {
+	Query *SelectStmt
+	Pos   Pos
+}
+
+// IntervalExpr is "INTERVAL value unit", an argument of DATE_ADD and
+// DATE_SUB. Unit is upper-cased and singular, e.g. DAY.
+type IntervalExpr struct {
+	Value Expr
+	Unit  string
+	Pos   Pos
+}
+
+// ExtractExpr is "EXTRACT(field FROM expr)". Field is upper-cased.
+type ExtractExpr struct {
+	Field string
+	Expr  Expr
+	Pos   Pos
+}
+
+func (e *Literal) Position() Pos       { return e.Pos }
+func (e *ColumnRef) Position() Pos     { return e.Pos }
+func (e *BinaryExpr) Position() Pos    { return e.Pos }
+func (e *UnaryExpr) Position() Pos     { return e.Pos }
+func (e *InExpr) Position() Pos        { return e.Pos }
+func (e *BetweenExpr) Position() Pos   { return e.Pos }
+func (e *IsNullExpr) Position() Pos    { return e.Pos }
+func (e *FuncCall) Position() Pos      { return e.Pos }
+func (e *AggregateCall) Position() Pos { return e.Pos }
+func (e *WindowCall) Position() Pos    { return e.Pos }
+func (e *SubqueryExpr) Position() Pos  { return e.Pos }
+func (e *ExistsExpr) Position() Pos    { return e.Pos }
+func (e *IntervalExpr) Position() Pos  { return e.Pos }
+func (e *ExtractExpr) Position() Pos   { return e.Pos }
+
+// TableRef names a table of the active database.
+type TableRef struct {
+	Name string
+	Pos  Pos
+}
+
+// Source is a table of the FROM clause, with an optional alias, or a
+// derived table "(SELECT ...) [AS] alias".
+type Source struct {
+	Table TableRef
+	Query *SelectStmt // nil for a table
+	CTE   *CTE        // the CTE the table name reads, if any
+	Alias string
+	Pos   Pos
+}
+
+// CTE is a common table expression of a WITH clause:
+// "name [(column, ...)] AS (SELECT ...)". The query of a recursive CTE is
+// a compound SELECT whose SELECTs from Compound[Step] on read the CTE.
+type CTE struct {
+	Name    string
+	Columns []string // nil to keep those of the query
+	Query   *SelectStmt
+	Step    int // -1 when the CTE is not recursive
+	Pos     Pos
+	refs    int // number of sources reading it, while parsing
+}
+
+// Name returns the name that qualifies the columns of the source: its
+// alias, or the name of the table.
+func (s *Source) Name() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Table.Name
+}
+
+// Join is a table joined to the tables before it in the FROM clause. Kind
+// is INNER, LEFT or CROSS (for a comma too).
+type Join struct {
+	Kind   string
+	Source *Source
+	On     Expr // nil for CROSS
+}
+
+// Compound is a SELECT combined by Op, one of UNION, UNION ALL, INTERSECT
+// and EXCEPT, with the rows of those before it.
+type Compound struct {
+	Op     string
+	Select *SelectStmt
+	Pos    Pos
+}
+
+// OrderBy is a key of an ORDER BY clause. Nulls is "FIRST" or "LAST", or
+// empty when NULLs come first in ascending order and last in descending
+// order.
+type OrderBy struct {
+	Expr  Expr
+	Desc  bool
+	Nulls string
+}
+
+// SelectItem is an entry of the SELECT list: "*" or "t.*", or an
+// expression with an optional alias.
+type SelectItem struct {
+	Star  bool
+	Table string // t of "t.*"
+	Expr  Expr
+	Alias string
+	Pos   Pos
+}
+
+// Name returns the column header of the item: its alias, the name of a
+// column, or the text of the expression.
+func (it SelectItem) Name() string {
+	if it.Alias != "" {
+		return it.Alias
+	}
+	if ref, ok := it.Expr.(*ColumnRef); ok {
+		return ref.Name
+	}
+	return exprText(it.Expr)
+}
+
+// walk calls fn for e and each of its sub-expressions, parents first. It
+// does not enter subqueries.
+func walk(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	for _, sub := range children(e) {
+		walk(sub, fn)
+	}
+}
+
+// children returns the operands of an expression.
+func children(e Expr) []Expr {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return []Expr{e.Left, e.Right}
+	case *UnaryExpr:
+		return []Expr{e.Operand}
+	case *InExpr:
+		return append([]Expr{e.Expr}, e.List...)
+	case *BetweenExpr:
+		return []Expr{e.Expr, e.Low, e.High}
+	case *IsNullExpr:
+		return []Expr{e.Expr}
+	case *FuncCall:
+		return e.Args
+	case *AggregateCall:
+		return append(e.Args[:len(e.Args):len(e.Args)], e.Over.exprs()...)
+	case *WindowCall:
+		return append(e.Args[:len(e.Args):len(e.Args)], e.Over.exprs()...)
+	case *IntervalExpr:
+		return []Expr{e.Value}
+	case *ExtractExpr:
+		return []Expr{e.Expr}
+	}
+	return nil
+}
+
+// precedence returns how tightly an operator binds; exprText uses it to
+// put back the parentheses an expression needs.
+func precedence(op string) int {
+	switch op {
+	case "OR":
+		return 1
+	case "AND":
+		return 2
+	case "NOT":
+		return 3
+	case "||":
+		return 5
+	case "+", "-":
+		return 6
+	case "*", "/", "%":
+		return 7
+	}
+	return 4 // comparisons
+}
+
+// negPrecedence is the precedence of unary minus.
+const negPrecedence = 8
+
+// exprText writes an expression back as SQL.
+func exprText(e Expr) string {
+	switch e := e.(type) {
+	case *Literal:
+		switch e.Kind {
+		case LitString:
+			return "'" + strings.ReplaceAll(e.Value, "'", "''") + "'"
+		case LitNull:
+			return "NULL"
+		case LitBlob:
+			return "X'" + e.Value + "'"
+		}
+		return e.Value
+	case *ColumnRef:
+		if e.Table != "" {
+			return e.Table + "." + e.Name
+		}
+		return e.Name
+	case *BinaryExpr:
+		prec := precedence(e.Op)
+		return operandText(e.Left, prec, false) + " " + e.Op + " " + operandText(e.Right, prec, true)
+	case *UnaryExpr:
+		if e.Op == "-" {
+			return "-" + operandText(e.Operand, negPrecedence, true)
+		}
+		return e.Op + " " + operandText(e.Operand, precedence(e.Op), false)
+	case *InExpr:
+		if e.Query != nil {
+			return exprText(e.Expr) + notText(e.Not) + " IN " + exprText(e.Query)
+		}
+		items := make([]string, len(e.List))
+		for i, item := range e.List {
+			items[i] = exprText(item)
+		}
+		return exprText(e.Expr) + notText(e.Not) + " IN (" + strings.Join(items, ", ") + ")"
+	case *BetweenExpr:
+		return exprText(e.Expr) + notText(e.Not) + " BETWEEN " + exprText(e.Low) + " AND " + exprText(e.High)
+	case *IsNullExpr:
+		if e.Not {
+			return exprText(e.Expr) + " IS NOT NULL"
+		}
+		return exprText(e.Expr) + " IS NULL"
+	case *FuncCall:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = exprText(arg)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")"
+	case *AggregateCall:
+		if e.Star {
+			return e.Name + "(*)"
+		}
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = exprText(arg)
+		}
+		distinct := ""
+		if e.Distinct {
+			distinct = "DISTINCT "
+		}
+		return e.Name + "(" + distinct + strings.Join(args, ", ") + ")" + e.Over.text()
+	case *WindowCall:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = exprText(arg)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")" + e.Over.text()
+	case *SubqueryExpr:
+		return "(" + e.Query.text() + ")"
+	case *ExistsExpr:
+		return "EXISTS (" + e.Query.text() + ")"
+	case *IntervalExpr:
+		return "INTERVAL " + exprText(e.Value) + " " + e.Unit
+	case *ExtractExpr:
+		return "EXTRACT(" + e.Field + " FROM " + exprText(e.Expr) + ")"
+	}
+	return "?"
+}
+
+// operandText writes an operand of an operator of precedence prec, in
+// parentheses when it binds less tightly (or as tightly, on the right of a
+// left-associative operator).
+func operandText(e Expr, prec int, right bool) string {
+	text := exprText(e)
+	inner := 0
+	switch e := e.(type) {
+	case *BinaryExpr:
+		inner = precedence(e.Op)
+	case *UnaryExpr:
+		inner = precedence(e.Op)
+		if e.Op == "-" {
+			inner = negPrecedence
+		}
+	case *InExpr, *BetweenExpr, *IsNullExpr:
+		inner = precedence("=")
+	case *Literal:
+		if e.Kind != LitNumber || !strings.HasPrefix(e.Value, "-") {
+			return text
+		}
+		inner = negPrecedence
+	default:
+		return text
+	}
+	if inner < prec || inner == prec && right {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func notText(not bool) string {
+	if not {
+		return " NOT"
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// parseCompound reads the SELECTs combined with stmt:
+//
+//	{ (UNION [ALL] | INTERSECT | EXCEPT) SELECT ... }
+//
+// Each is a SELECT without ORDER BY, LIMIT and OFFSET. They combine from
+// left to right.
+func (p *parser) parseCompound(stmt *SelectStmt) error {
+	for p.isKeyword("UNION", "INTERSECT", "EXCEPT") {
+		tok := p.next()
+		c := Compound{Op: tok.keyword(), Pos: tok.Pos}
+		if c.Op == "UNION" && p.acceptKeyword("ALL") {
+			c.Op = "UNION ALL"
+		}
+		if _, err := p.expectKeyword("SELECT"); err != nil {
+			return err
+		}
+		var err error
+		if c.Select, err = p.selectCore(); err != nil {
+			return err
+		}
+		stmt.Compound = append(stmt.Compound, c)
+	}
+	return nil
+}
+
+// combineWith adds to res, from left to right, the rows of the SELECTs of
+// compound. correlated reports whether they depend on the rows of outer.
+func combineWith(res *result, compound []Compound, q *query, outer *scope) (correlated bool, err error) {
+	for _, c := range compound {
+		other, otherCorrelated, err := c.Select.runCore(q, outer)
+		if err != nil {
+			return false, err
+		}
+		if err := checkColumnCount(c, res, other); err != nil {
+			return false, err
+		}
+		res.rows = combine(c.Op, res.rows, other.rows)
+		correlated = correlated || otherCorrelated
+	}
+	return correlated, nil
+}
+
+// checkColumnCount reports SELECTs combined by c returning different
+// numbers of columns.
+func checkColumnCount(c Compound, res, other *result) error {
+	if len(other.cols) != len(res.cols) {
+		return fmt.Errorf("%s: the SELECTs of %s return %d and %d columns", c.Pos, c.Op, len(res.cols), len(other.cols))
+	}
+	return nil
+}
+
+// sortResult applies ORDER BY, LIMIT and OFFSET to the combined result of
+// a compound SELECT.
+func (s *SelectStmt) sortResult(res *result) error {
+	if len(s.OrderBy) > 0 {
+		keys := make([][]db.Value, len(res.rows))
+		for _, order := range s.OrderBy {
+			i, err := resultColumn(res, order.Expr)
+			if err != nil {
+				return err
+			}
+			for j, row := range res.rows {
+				keys[j] = append(keys[j], row[i])
+			}
+		}
+		sortByKeys(res.rows, keys, s.OrderBy)
+	}
+	res.rows = page(res.rows, s.Limit, s.Offset)
+	return nil
+}
+
+// combine returns the rows of left and right combined by op. Except for
+// UNION ALL, the result has no duplicate rows; rows come in the order they
+// are first found.
+func combine(op string, left, right [][]db.Value) [][]db.Value {
+	if op == "UNION ALL" {
+		return append(left[:len(left):len(left)], right...)
+	}
+
+	inRight := make(map[string]bool, len(right))
+	for _, row := range right {
+		inRight[rowKey(row)] = true
+	}
+	var rows [][]db.Value
+	seen := make(map[string]bool)
+	add := func(row []db.Value, key string) {
+		if !seen[key] {
+			seen[key] = true
+			rows = append(rows, row)
+		}
+	}
+	for _, row := range left {
+		key := rowKey(row)
+		switch {
+		case op == "INTERSECT" && !inRight[key], op == "EXCEPT" && inRight[key]:
+			continue
+		}
+		add(row, key)
+	}
+	if op == "UNION" {
+		for _, row := range right {
+			add(row, rowKey(row))
+		}
+	}
+	return rows
+}
+
+// rowKey returns a text that is the same for rows whose values are, as
+// GROUP BY sees them, the same.
+func rowKey(row []db.Value) string {
+	var key strings.Builder
+	for _, v := range row {
+		key.WriteString(groupKey(v))
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// resultColumn returns the index of the result column an ORDER BY key of
+// a compound SELECT names, or is the position of.
+func resultColumn(res *result, key Expr) (int, error) {
+	if lit, ok := position(key); ok {
+		return columnPosition(lit, len(res.cols))
+	}
+	if ref, ok := key.(*ColumnRef); ok && ref.Table == "" {
+		for i, name := range res.cols {
+			if name == ref.Name {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%s: ORDER BY of a compound SELECT must name a column of its result or give its position", key.Position())
+}
@@ -0,0 +1,17 @@
+package sql
+
+import "testing"
+
+func TestCompound(t *testing.T) {
+	d := openTestDB(t, append(usersSchema, ordersSchema...)...)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT id FROM users UNION SELECT user_id FROM orders ORDER BY 1", want: []string{"1", "2", "3", "4", "9"}},
+		{query: "SELECT user_id FROM orders WHERE id < 12 UNION ALL SELECT id FROM users WHERE id = 1", want: []string{"1", "1", "1"}},
+		{query: "SELECT id FROM users INTERSECT SELECT user_id FROM orders", want: []string{"1", "2"}},
+		{query: "SELECT id FROM users EXCEPT SELECT user_id FROM orders", want: []string{"3", "4"}},
+		{query: "SELECT city FROM users WHERE city IS NOT NULL UNION SELECT 'Nice' FROM users ORDER BY city DESC LIMIT 2", want: []string{"Paris", "Nice"}},
+		{query: "SELECT id FROM users UNION ALL SELECT id FROM orders ORDER BY id LIMIT 3 OFFSET 3", want: []string{"4", "10", "11"}},
+		{query: "SELECT id FROM users UNION SELECT user_id FROM orders EXCEPT SELECT id FROM users", want: []string{"9"}},
+		{query: "SELECT id, name FROM users UNION SELECT id FROM orders", err: "column"},
+	})
+}
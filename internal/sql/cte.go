@@ -0,0 +1,248 @@
+package sql
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// maxRecursion bounds the steps of a recursive CTE, which would otherwise
+// never end on a cycle of rows.
+const maxRecursion = 1000
+
+// parseWith reads "WITH [RECURSIVE] cte, ..." and the SELECT, INSERT,
+// UPDATE or DELETE statement that follows, where the CTEs can be read as
+// tables. With RECURSIVE, a CTE may read itself.
+func (p *parser) parseWith() (Statement, error) {
+	recursive := p.acceptKeyword("RECURSIVE")
+	first := len(p.ctes)
+	for {
+		tok := p.peek()
+		c, err := p.cte(recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range p.ctes[first : len(p.ctes)-1] {
+			if other.Name == c.Name {
+				return nil, syntaxError(tok.Pos, fmt.Sprintf("CTE '%s' is defined twice", c.Name))
+			}
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if !p.isKeyword("SELECT", "INSERT", "UPDATE", "DELETE") {
+		return nil, p.unexpected("SELECT, INSERT, UPDATE or DELETE")
+	}
+	return p.parseStatement()
+}
+
+// cte reads "name [(column, ...)] AS (SELECT ...)" and makes the CTE
+// visible to the rest of the statement, and to its own query when
+// recursive.
+func (p *parser) cte(recursive bool) (*CTE, error) {
+	name, err := p.ident("a CTE name")
+	if err != nil {
+		return nil, err
+	}
+	c := &CTE{Name: name.Text, Step: -1, Pos: name.Pos}
+	if p.isSymbol("(") {
+		cols, err := p.columnList()
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range cols {
+			c.Columns = append(c.Columns, col.Name)
+		}
+	}
+	if _, err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+
+	if !recursive {
+		if c.Query, err = p.subquery(); err != nil {
+			return nil, err
+		}
+		p.ctes = append(p.ctes, c)
+		return c, nil
+	}
+
+	p.ctes = append(p.ctes, c)
+	if c.Query, err = p.subquery(); err != nil {
+		return nil, err
+	}
+	return c, c.findStep()
+}
+
+// findStep sets Step, the first SELECT of the query of a recursive CTE
+// that reads the CTE. The SELECTs before it give the first rows; those
+// from it on are added by UNION or UNION ALL.
+func (c *CTE) findStep() error {
+	uses := c.Query.reads(c)
+	if uses > 0 {
+		return syntaxError(c.Pos, fmt.Sprintf("the first SELECT of recursive CTE '%s' cannot read it", c.Name))
+	}
+	for i, part := range c.Query.Compound {
+		n := part.Select.reads(c)
+		if n == 0 {
+			continue
+		}
+		if part.Op != "UNION" && part.Op != "UNION ALL" {
+			return syntaxError(part.Pos, fmt.Sprintf("recursive CTE '%s' must add its rows with UNION or UNION ALL", c.Name))
+		}
+		if c.Step < 0 {
+			c.Step = i
+		}
+		uses += n
+	}
+	if uses != c.refs {
+		return syntaxError(c.Pos, fmt.Sprintf("recursive CTE '%s' can only be read in the FROM clause of its own SELECTs", c.Name))
+	}
+	return nil
+}
+
+// reads returns the number of sources of the FROM clause of s (not of its
+// subqueries) reading c.
+func (s *SelectStmt) reads(c *CTE) int {
+	n := 0
+	if s.From.CTE == c {
+		n++
+	}
+	for _, j := range s.Joins {
+		if j.Source.CTE == c {
+			n++
+		}
+	}
+	return n
+}
+
+// lookupCTE returns the CTE a table name of the FROM clause reads, or nil.
+func (p *parser) lookupCTE(name string) *CTE {
+	for i := len(p.ctes) - 1; i >= 0; i-- {
+		if p.ctes[i].Name == name {
+			p.ctes[i].refs++
+			return p.ctes[i]
+		}
+	}
+	return nil
+}
+
+// cte returns the rows of c, computed once per statement. While a
+// recursive CTE is computed, reading it gives the rows found by the last
+// step, and working is then true.
+func (q *query) cte(c *CTE) (res *result, working bool, err error) {
+	if res, ok := q.working[c]; ok {
+		return res, true, nil
+	}
+	if res, ok := q.results[c.Query]; ok {
+		return res, false, nil
+	}
+
+	if c.Step < 0 {
+		if res, _, err = c.Query.run(q, nil); err == nil {
+			res, err = c.named(res)
+		}
+	} else {
+		res, err = c.runRecursive(q)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	q.results[c.Query] = res
+	return res, false, nil
+}
+
+// named renames the columns of res after those listed by the CTE.
+func (c *CTE) named(res *result) (*result, error) {
+	if c.Columns == nil {
+		return res, nil
+	}
+	if len(c.Columns) != len(res.cols) {
+		return nil, fmt.Errorf("%s: CTE '%s' names %d columns but its query returns %d", c.Pos, c.Name, len(c.Columns), len(res.cols))
+	}
+	return &result{cols: c.Columns, rows: res.rows}, nil
+}
+
+// runRecursive computes a recursive CTE: the rows of the SELECTs before
+// Step, then those the SELECTs from Step on find reading the rows added
+// by the step before, until a step adds none. UNION drops the rows found
+// already.
+func (c *CTE) runRecursive(q *query) (*result, error) {
+	s := c.Query
+	res, _, err := s.runCore(q, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := combineWith(res, s.Compound[:c.Step], q, nil); err != nil {
+		return nil, err
+	}
+	if res, err = c.named(res); err != nil {
+		return nil, err
+	}
+
+	distinct := slices.ContainsFunc(s.Compound[c.Step:], func(part Compound) bool { return part.Op == "UNION" })
+	seen := make(map[string]bool)
+	first := res.rows[:0:0]
+	for _, row := range res.rows {
+		key := rowKey(row)
+		if !distinct || !seen[key] {
+			first = append(first, row)
+		}
+		seen[key] = true
+	}
+	res = &result{cols: res.cols, rows: first}
+	last := res
+	defer delete(q.working, c)
+	for step := 0; len(last.rows) > 0; step++ {
+		// Without ORDER BY, the first rows found are those LIMIT keeps, so
+		// the steps after them are not needed.
+		if len(s.OrderBy) == 0 && s.Limit >= 0 && len(res.rows) >= s.Offset+s.Limit {
+			break
+		}
+		if step == maxRecursion {
+			return nil, fmt.Errorf("%s: recursive CTE '%s' did not end after %d steps", c.Pos, c.Name, maxRecursion)
+		}
+
+		q.working[c] = last
+		found := &result{cols: res.cols}
+		for _, part := range s.Compound[c.Step:] {
+			other, _, err := part.Select.runCore(q, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkColumnCount(part, res, other); err != nil {
+				return nil, err
+			}
+			for _, row := range other.rows {
+				key := rowKey(row)
+				if part.Op == "UNION" && seen[key] {
+					continue
+				}
+				seen[key] = true
+				found.rows = append(found.rows, row)
+			}
+		}
+		res.rows = append(res.rows, found.rows...)
+		last = found
+	}
+
+	if err := s.sortResult(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cteTable returns the columns and rows of a source reading a CTE.
+func cteTable(src *Source, sc *scope) (db.Schema, []db.Row, error) {
+	res, working, err := sc.q.cte(src.CTE)
+	if err != nil {
+		return db.Schema{}, nil, err
+	}
+	// The rows of a step change with each step
+	if working {
+		*sc.correlated = true
+	}
+	return tableOf(src, res)
+}
@@ -0,0 +1,89 @@
+package sql
+
+import "testing"
+
+func TestCTE(t *testing.T) {
+	d := openTestDB(t, append(usersSchema, ordersSchema...)...)
+	checkQueries(t, d, []queryTest{
+		{
+			query: "WITH totals AS (SELECT user_id, SUM(amount) AS total FROM orders GROUP BY user_id) " +
+				"SELECT name, total FROM users JOIN totals ON totals.user_id = users.id ORDER BY total DESC",
+			want: []string{"ann|12", "bob|3"},
+		},
+		{
+			query: "WITH big(uid) AS (SELECT user_id FROM orders WHERE amount > 4), named AS (SELECT name FROM users WHERE id IN (SELECT uid FROM big)) " +
+				"SELECT name FROM named",
+			want: []string{"ann"},
+		},
+		{
+			query: "WITH paris AS (SELECT id FROM users WHERE city = 'Paris') SELECT COUNT(*) FROM paris p1 CROSS JOIN paris p2",
+			want:  []string{"4"},
+		},
+		{
+			query: "WITH a AS (SELECT id FROM users) SELECT id FROM b",
+			err:   "table 'b' not found",
+		},
+	})
+
+	exec(t, d,
+		"CREATE TABLE archive (id INT PRIMARY KEY, amount INT)",
+		"WITH small AS (SELECT id, amount FROM orders WHERE amount < 5) INSERT INTO archive (id, amount) SELECT id, amount FROM small",
+		"WITH small AS (SELECT id FROM archive) DELETE FROM orders WHERE id IN (SELECT id FROM small)",
+		"WITH top AS (SELECT MAX(amount) AS m FROM orders) UPDATE orders SET amount = amount * 2 WHERE amount = (SELECT m FROM top)",
+	)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT id, amount FROM archive", want: []string{"12|3", "13|1"}},
+		{query: "SELECT id, amount FROM orders", want: []string{"10|5", "11|14"}},
+	})
+}
+
+func TestRecursiveCTE(t *testing.T) {
+	d := openTestDB(t,
+		"CREATE TABLE staff (id INT PRIMARY KEY, name TEXT, boss INT)",
+		"INSERT INTO staff (id, name, boss) VALUES (1, 'ann', NULL)",
+		"INSERT INTO staff (id, name, boss) VALUES (2, 'bob', 1)",
+		"INSERT INTO staff (id, name, boss) VALUES (3, 'cat', 2)",
+		"INSERT INTO staff (id, name, boss) VALUES (4, 'dan', 1)",
+		"CREATE TABLE one (id INT PRIMARY KEY)",
+		"INSERT INTO one (id) VALUES (1)",
+	)
+	checkQueries(t, d, []queryTest{
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT x FROM n",
+			want:  []string{"1", "2", "3", "4", "5"},
+		},
+		// Without ORDER BY, LIMIT ends a recursion that has no end.
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION ALL SELECT x + 1 FROM n LIMIT 3) SELECT x FROM n",
+			want:  []string{"1", "2", "3"},
+		},
+		// With ORDER BY, LIMIT keeps the first rows of the sorted
+		// result, not the first rows found.
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION ALL SELECT x + 1 FROM n WHERE x < 10 ORDER BY x DESC LIMIT 3) SELECT x FROM n",
+			want:  []string{"10", "9", "8"},
+		},
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION ALL SELECT x + 1 FROM n WHERE x < 10 ORDER BY x DESC LIMIT 2 OFFSET 1) SELECT x FROM n",
+			want:  []string{"9", "8"},
+		},
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION SELECT x FROM n) SELECT x FROM n",
+			want:  []string{"1"},
+		},
+		{
+			query: "WITH RECURSIVE chain(id, depth) AS (SELECT id, 0 FROM staff WHERE boss IS NULL " +
+				"UNION ALL SELECT s.id, c.depth + 1 FROM staff s JOIN chain c ON s.boss = c.id) " +
+				"SELECT name, depth FROM chain JOIN staff ON chain.id = staff.id ORDER BY depth, name",
+			want: []string{"ann|0", "bob|1", "dan|1", "cat|2"},
+		},
+		{
+			query: "WITH RECURSIVE n(x) AS (SELECT id FROM one UNION ALL SELECT x + 1 FROM n) SELECT x FROM n",
+			err:   "did not end",
+		},
+		{
+			query: "WITH n(x, y) AS (SELECT id FROM one) SELECT x FROM n",
+			err:   "names 2 columns but its query returns 1",
+		},
+	})
+}
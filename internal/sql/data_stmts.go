@@ -3,494 +3,258 @@ package sql
 import (
 	"errors"
 	"fmt"
-	"regexp"
-	"strings"
 
 	"github.com/abmcmanu/go-mini-sqlite/internal/db"
-	"github.com/abmcmanu/go-mini-sqlite/internal/util"
 )
 
 type InsertStmt struct {
-	Table  string
-	Cols   []string
-	Values []string
+	Table  TableRef
+	Cols   []*ColumnRef
+	Values []Expr
+	Query  *SelectStmt // inserts its rows instead of Values when set
+	Pos    Pos         // of VALUES or SELECT
 }
 
-func parseInsert(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)INSERT\s+INTO\s+([a-zA-Z0-9_]+)\s*\(([^)]+)\)\s*VALUES\s*\(([^)]+)\);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 4 {
-		return nil, errors.New("invalid INSERT syntax")
-	}
-
-	table := m[1]
-	cols := splitAndTrim(m[2])
-	vals := splitAndTrim(m[3])
+// parseInsert reads:
+//
+//	INSERT INTO table (column, ...) VALUES (value, ...)
+//	INSERT INTO table (column, ...) SELECT ...
 
-	if len(cols) != len(vals) {
-		return nil, errors.New("column count != value count")
-	}
-	return &InsertStmt{Table: table, Cols: cols, Values: vals}, nil
-}
-
-func (s *InsertStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
-		return errors.New("no database selected — use USE <database>")
+func (p *parser) parseInsert() (Statement, error) {
+	if _, err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
 	}
-
-	t, err := d.GetTable(s.Table)
+	table, err := p.tableRef()
 	if err != nil {
-		return err
-	}
-
-	row := make(map[string]string)
-	for i, col := range s.Cols {
-		row[col] = strings.Trim(s.Values[i], `"`)
-	}
-
-	return t.Insert(row)
-}
-
-type SelectStmt struct {
-	Table            string
-	Where            *WhereClause
-	OrderByColumn    string
-	OrderByDirection string
-	Limit            int
-	AggregateFunc    string // COUNT, SUM, AVG
-	AggregateColumn  string // column name or "*" for COUNT(*)
-}
-
-func parseSelect(query string) (Statement, error) {
-	queryUpper := strings.ToUpper(query)
-
-	// Check for aggregate functions: COUNT, SUM, AVG
-	if strings.Contains(queryUpper, "COUNT(") || strings.Contains(queryUpper, "SUM(") || strings.Contains(queryUpper, "AVG(") {
-		return parseAggregateSelect(query)
-	}
-
-	// Check for AND/OR in WHERE clause
-	if strings.Contains(queryUpper, " AND ") || strings.Contains(queryUpper, " OR ") {
-		return parseSelectWithMultipleConditions(query)
-	}
-
-	// Regular SELECT * FROM table [WHERE col=val] [ORDER BY col [ASC|DESC]] [LIMIT n]
-	re := regexp.MustCompile(`(?i)SELECT\s+\*\s+FROM\s+([a-zA-Z0-9_]+)(?:\s+WHERE\s+([a-zA-Z0-9_]+)\s*=\s*"?([^"]+)"?)?(?:\s+ORDER\s+BY\s+([a-zA-Z0-9_]+)(?:\s+(ASC|DESC))?)?(?:\s+LIMIT\s+(\d+))?;?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid SELECT syntax")
-	}
-
-	stmt := &SelectStmt{Table: m[1]}
-
-	if len(m) >= 4 && m[2] != "" {
-		stmt.Where = &WhereClause{
-			Conditions: []Condition{{Column: m[2], Operator: "=", Value: m[3]}},
-			Operator:   "AND",
-		}
-	}
-
-	if len(m) >= 5 && m[4] != "" {
-		stmt.OrderByColumn = m[4]
-		if len(m) >= 6 && m[5] != "" {
-			stmt.OrderByDirection = strings.ToUpper(m[5])
-		} else {
-			stmt.OrderByDirection = "ASC"
-		}
+		return nil, err
 	}
-
-	if len(m) >= 7 && m[6] != "" {
-		limit, err := parseNumber(m[6])
-		if err != nil || limit < 0 {
-			return nil, errors.New("LIMIT must be a positive number")
-		}
-		stmt.Limit = int(limit)
+	cols, err := p.columnList()
+	if err != nil {
+		return nil, err
 	}
 
-	return stmt, nil
-}
-
-func parseAggregateSelect(query string) (Statement, error) {
-	// SELECT COUNT(*) FROM table [WHERE conditions]
-	// SELECT SUM(column) FROM table [WHERE conditions]
-	// SELECT AVG(column) FROM table [WHERE conditions]
-
-	queryUpper := strings.ToUpper(query)
-
-	// Check for AND/OR in WHERE clause
-	if strings.Contains(queryUpper, " AND ") || strings.Contains(queryUpper, " OR ") {
-		re := regexp.MustCompile(`(?i)SELECT\s+(COUNT|SUM|AVG)\s*\(\s*([a-zA-Z0-9_*]+)\s*\)\s+FROM\s+([a-zA-Z0-9_]+)\s+WHERE\s+(.+?);?$`)
-		m := re.FindStringSubmatch(query)
-		if len(m) < 5 {
-			return nil, errors.New("invalid aggregate SELECT syntax")
-		}
-
-		whereClause, err := parseWhereClause(m[4])
+	if tok := p.peek(); p.acceptKeyword("SELECT") {
+		query, err := p.selectStmt()
 		if err != nil {
 			return nil, err
 		}
-
-		return &SelectStmt{
-			Table:           m[3],
-			AggregateFunc:   strings.ToUpper(m[1]),
-			AggregateColumn: m[2],
-			Where:           whereClause,
-		}, nil
-	}
-
-	// Single condition or no WHERE
-	re := regexp.MustCompile(`(?i)SELECT\s+(COUNT|SUM|AVG)\s*\(\s*([a-zA-Z0-9_*]+)\s*\)\s+FROM\s+([a-zA-Z0-9_]+)(?:\s+WHERE\s+([a-zA-Z0-9_]+)\s*=\s*"?([^"]+)"?)?;?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 4 {
-		return nil, errors.New("invalid aggregate SELECT syntax")
-	}
-
-	stmt := &SelectStmt{
-		Table:           m[3],
-		AggregateFunc:   strings.ToUpper(m[1]),
-		AggregateColumn: m[2],
-	}
-
-	if len(m) >= 6 && m[4] != "" {
-		stmt.Where = &WhereClause{
-			Conditions: []Condition{{Column: m[4], Operator: "=", Value: m[5]}},
-			Operator:   "AND",
-		}
-	}
-
-	return stmt, nil
-}
-
-func parseSelectWithMultipleConditions(query string) (Statement, error) {
-	// SELECT * FROM table WHERE col1=val1 AND/OR col2=val2 [ORDER BY col [ASC|DESC]] [LIMIT n]
-	re := regexp.MustCompile(`(?i)SELECT\s+\*\s+FROM\s+([a-zA-Z0-9_]+)\s+WHERE\s+(.+?)(?:\s+ORDER\s+BY\s+([a-zA-Z0-9_]+)(?:\s+(ASC|DESC))?)?\s*(?:LIMIT\s+(\d+))?\s*;?$`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 3 {
-		return nil, errors.New("invalid SELECT syntax with multiple conditions")
+		return &InsertStmt{Table: table, Cols: cols, Query: query, Pos: tok.Pos}, nil
 	}
 
-	whereClause, err := parseWhereClause(m[2])
+	valuesTok, err := p.expectKeyword("VALUES")
 	if err != nil {
 		return nil, err
 	}
-
-	stmt := &SelectStmt{
-		Table: m[1],
-		Where: whereClause,
-	}
-
-	if len(m) >= 4 && m[3] != "" {
-		stmt.OrderByColumn = m[3]
-		if len(m) >= 5 && m[4] != "" {
-			stmt.OrderByDirection = strings.ToUpper(m[4])
-		} else {
-			stmt.OrderByDirection = "ASC"
-		}
+	if _, err := p.expectSymbol("("); err != nil {
+		return nil, err
 	}
-
-	if len(m) >= 6 && m[5] != "" {
-		limit, err := parseNumber(m[5])
-		if err != nil || limit < 0 {
-			return nil, errors.New("LIMIT must be a positive number")
+	var vals []Expr
+	for {
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
-		stmt.Limit = int(limit)
-	}
-
-	return stmt, nil
-}
-
-func parseWhereClause(whereStr string) (*WhereClause, error) {
-	whereStr = strings.TrimSpace(whereStr)
-	queryUpper := strings.ToUpper(whereStr)
-
-	var operator string
-	var conditionParts []string
-
-	if strings.Contains(queryUpper, " AND ") {
-		operator = "AND"
-		conditionParts = strings.Split(whereStr, " AND ")
-		// Fallback to lowercase
-		if len(conditionParts) == 1 {
-			conditionParts = strings.Split(whereStr, " and ")
+		if err := noAggregate(v, "VALUES"); err != nil {
+			return nil, err
 		}
-	} else if strings.Contains(queryUpper, " OR ") {
-		operator = "OR"
-		conditionParts = strings.Split(whereStr, " OR ")
-		// Fallback to lowercase
-		if len(conditionParts) == 1 {
-			conditionParts = strings.Split(whereStr, " or ")
+		vals = append(vals, v)
+		if !p.acceptSymbol(",") {
+			break
 		}
-	} else {
-		return nil, errors.New("no AND/OR operator found")
 	}
-
-	var conditions []Condition
-	for _, part := range conditionParts {
-		part = strings.TrimSpace(part)
-
-		// Try LIKE first
-		reLike := regexp.MustCompile(`(?i)([a-zA-Z0-9_]+)\s+LIKE\s+"?([^"]+)"?`)
-		m := reLike.FindStringSubmatch(part)
-		if len(m) >= 3 {
-			conditions = append(conditions, Condition{
-				Column:   m[1],
-				Operator: "LIKE",
-				Value:    strings.Trim(m[2], `"`),
-			})
-			continue
-		}
-
-		// Try = operator
-		reEq := regexp.MustCompile(`([a-zA-Z0-9_]+)\s*=\s*"?([^"]+)"?`)
-		m = reEq.FindStringSubmatch(part)
-		if len(m) < 3 {
-			return nil, fmt.Errorf("invalid condition: %s", part)
-		}
-		conditions = append(conditions, Condition{
-			Column:   m[1],
-			Operator: "=",
-			Value:    strings.Trim(m[2], `"`),
-		})
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
 	}
 
-	return &WhereClause{
-		Conditions: conditions,
-		Operator:   operator,
-	}, nil
+	if len(cols) != len(vals) {
+		return nil, syntaxError(valuesTok.Pos, fmt.Sprintf("%d column(s) but %d value(s)", len(cols), len(vals)))
+	}
+	return &InsertStmt{Table: table, Cols: cols, Values: vals, Pos: valuesTok.Pos}, nil
 }
 
-func (s *SelectStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
+func (s *InsertStmt) Exec(d *db.Database) error {
+	if d.Active() == "" {
 		return errors.New("no database selected — use USE <database>")
 	}
 
-	t, err := d.GetTable(s.Table)
-	if err != nil {
-		return err
-	}
-
-	var rows []map[string]string
-	if s.Where != nil {
-		// Filter rows using WhereClause
-		allRows := t.SelectAll()
-		for _, row := range allRows {
-			if s.Where.Evaluate(row) {
-				rows = append(rows, row)
-			}
+	var count int
+	err := withTx(d, func(tx *db.Tx) error {
+		t, err := d.GetTable(s.Table.Name)
+		if err != nil {
+			return err
 		}
-	} else {
-		rows = t.SelectAll()
-	}
-
-	// Handle aggregate functions
-	if s.AggregateFunc != "" {
-		return s.execAggregate(rows)
-	}
-
-	if s.OrderByColumn != "" {
-		sortRows(rows, s.OrderByColumn, s.OrderByDirection)
-	}
-
-	if s.Limit > 0 && s.Limit < len(rows) {
-		rows = rows[:s.Limit]
-	}
-
-	var cols []string
-	for _, c := range t.Schema.Columns {
-		cols = append(cols, c.Name)
-	}
-
-	util.PrintTable(cols, rows)
-	return nil
-}
 
-func (s *SelectStmt) execAggregate(rows []map[string]string) error {
-	switch s.AggregateFunc {
-	case "COUNT":
-		fmt.Printf("%d\n", len(rows))
-		return nil
-
-	case "SUM":
-		if s.AggregateColumn == "*" {
-			return errors.New("SUM requires a column name, not *")
-		}
-		var sum float64
-		for _, row := range rows {
-			val, exists := row[s.AggregateColumn]
-			if !exists {
-				return fmt.Errorf("column '%s' not found", s.AggregateColumn)
+		if s.Query == nil {
+			row := make(db.Row)
+			for i, col := range s.Cols {
+				v, err := evalValue(s.Values[i], nil)
+				if err != nil {
+					return err
+				}
+				row[col.Name] = v
 			}
-			num, err := parseNumber(val)
-			if err != nil {
-				return fmt.Errorf("cannot SUM non-numeric value: %s", val)
-			}
-			sum += num
+			return tx.Insert(t, row)
 		}
-		fmt.Printf("%.2f\n", sum)
-		return nil
 
-	case "AVG":
-		if s.AggregateColumn == "*" {
-			return errors.New("AVG requires a column name, not *")
+		// Every row is read before any is inserted
+		res, _, err := s.Query.run(newQuery(d, tx), nil)
+		if err != nil {
+			return err
 		}
-		if len(rows) == 0 {
-			fmt.Println("0")
-			return nil
+		if len(res.cols) != len(s.Cols) {
+			return fmt.Errorf("%s: %d column(s) but the query returns %d", s.Pos, len(s.Cols), len(res.cols))
 		}
-		var sum float64
-		for _, row := range rows {
-			val, exists := row[s.AggregateColumn]
-			if !exists {
-				return fmt.Errorf("column '%s' not found", s.AggregateColumn)
+		for _, values := range res.rows {
+			row := make(db.Row)
+			for i, col := range s.Cols {
+				row[col.Name] = values[i]
 			}
-			num, err := parseNumber(val)
-			if err != nil {
-				return fmt.Errorf("cannot AVG non-numeric value: %s", val)
+			if err := tx.Insert(t, row); err != nil {
+				return err
 			}
-			sum += num
+			count++
 		}
-		avg := sum / float64(len(rows))
-		fmt.Printf("%.2f\n", avg)
 		return nil
-
-	default:
-		return fmt.Errorf("unknown aggregate function: %s", s.AggregateFunc)
+	})
+	if err != nil || s.Query == nil {
+		return err
 	}
+
+	fmt.Printf("%d row(s) inserted.\n", count)
+	return nil
 }
 
 type UpdateStmt struct {
-	Table   string
-	Updates map[string]string
-	Where   *WhereClause
+	Table TableRef
+	Set   []Assignment
+	Where Expr
 }
 
-func parseUpdate(query string) (Statement, error) {
-	queryUpper := strings.ToUpper(query)
-
-	// Check for AND/OR in WHERE clause
-	if strings.Contains(queryUpper, " AND ") || strings.Contains(queryUpper, " OR ") {
-		re := regexp.MustCompile(`(?i)UPDATE\s+([a-zA-Z0-9_]+)\s+SET\s+(.+?)\s+WHERE\s+(.+?);?$`)
-		m := re.FindStringSubmatch(query)
-		if len(m) < 4 {
-			return nil, errors.New("invalid UPDATE syntax with multiple conditions")
-		}
+// Assignment is one "column = value" of an UPDATE.
+type Assignment struct {
+	Column *ColumnRef
+	Value  Expr
+}
 
-		table := m[1]
-		setPart := m[2]
+func (p *parser) parseUpdate() (Statement, error) {
+	table, err := p.tableRef()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
 
-		updates := make(map[string]string)
-		assignments := splitAndTrim(setPart)
-		for _, assign := range assignments {
-			parts := strings.Split(assign, "=")
-			if len(parts) != 2 {
-				return nil, fmt.Errorf("invalid assignment: %s", assign)
-			}
-			colName := strings.TrimSpace(parts[0])
-			colValue := strings.Trim(strings.TrimSpace(parts[1]), `"`)
-			updates[colName] = colValue
+	stmt := &UpdateStmt{Table: table}
+	seen := make(map[string]bool)
+	for {
+		col, err := p.columnRef()
+		if err != nil {
+			return nil, err
 		}
-
-		whereClause, err := parseWhereClause(m[3])
+		if seen[col.Name] {
+			return nil, syntaxError(col.Pos, fmt.Sprintf("column '%s' is assigned twice", col.Name))
+		}
+		seen[col.Name] = true
+		if _, err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
 		if err != nil {
 			return nil, err
 		}
-
-		return &UpdateStmt{
-			Table:   table,
-			Updates: updates,
-			Where:   whereClause,
-		}, nil
+		if err := noAggregate(value, "SET"); err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, Assignment{Column: col, Value: value})
+		if !p.acceptSymbol(",") {
+			break
+		}
 	}
 
-	// Single condition
-	re := regexp.MustCompile(`(?i)UPDATE\s+([a-zA-Z0-9_]+)\s+SET\s+(.+?)\s+WHERE\s+([a-zA-Z0-9_]+)\s*=\s*"?([^";]+)"?;?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 5 {
-		return nil, errors.New("invalid UPDATE syntax (expected: UPDATE table SET col=val WHERE col=val)")
+	if _, err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
 	}
-
-	table := m[1]
-	setPart := m[2]
-
-	updates := make(map[string]string)
-	assignments := splitAndTrim(setPart)
-	for _, assign := range assignments {
-		parts := strings.Split(assign, "=")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid assignment: %s", assign)
-		}
-		colName := strings.TrimSpace(parts[0])
-		colValue := strings.Trim(strings.TrimSpace(parts[1]), `"`)
-		updates[colName] = colValue
+	if stmt.Where, err = p.parseExpr(); err != nil {
+		return nil, err
 	}
-
-	return &UpdateStmt{
-		Table:   table,
-		Updates: updates,
-		Where: &WhereClause{
-			Conditions: []Condition{{Column: m[3], Operator: "=", Value: m[4]}},
-			Operator:   "AND",
-		},
-	}, nil
+	if err := noAggregate(stmt.Where, "WHERE"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
 }
 
 func (s *UpdateStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
+	if d.Active() == "" {
 		return errors.New("no database selected — use USE <database>")
 	}
 
-	t, err := d.GetTable(s.Table)
-	if err != nil {
-		return err
-	}
+	var count int
+	err := withTx(d, func(tx *db.Tx) error {
+		t, err := d.GetTable(s.Table.Name)
+		if err != nil {
+			return err
+		}
 
-	// Get matching rows
-	allRows := t.SelectAll()
-	var matchingRows []map[string]string
-	for _, row := range allRows {
-		if s.Where.Evaluate(row) {
-			matchingRows = append(matchingRows, row)
+		// Get matching rows
+		sc := newScope(t, newQuery(d, tx))
+		matchingRows, err := filterRows(s.Where, sc, tx.Rows(t))
+		if err != nil {
+			return err
 		}
-	}
 
-	if len(matchingRows) == 0 {
-		fmt.Println("0 row(s) updated.")
-		return nil
-	}
+		if len(matchingRows) == 0 {
+			return nil
+		}
 
-	// Validate and update
-	cols := t.Schema.ColumnsMap()
-	pkName := t.PrimaryKey()
+		// Validate and update
+		cols := t.Schema.ColumnsMap()
+		pkName := t.PrimaryKey()
 
-	for colName, newVal := range s.Updates {
-		col, exists := cols[colName]
-		if !exists {
-			return fmt.Errorf("column '%s' does not exist", colName)
-		}
-		if col.PrimaryKey {
-			return fmt.Errorf("cannot update PRIMARY KEY column '%s'", colName)
-		}
-		if col.NotNull && newVal == "" {
-			return fmt.Errorf("column '%s' is NOT NULL", colName)
+		for _, a := range s.Set {
+			col, exists := cols[a.Column.Name]
+			if !exists {
+				return fmt.Errorf("column '%s' does not exist", a.Column.Name)
+			}
+			if col.PrimaryKey {
+				return fmt.Errorf("cannot update PRIMARY KEY column '%s'", a.Column.Name)
+			}
 		}
-	}
 
-	count := 0
-	for _, row := range matchingRows {
-		pkVal := row[pkName]
-		updatedRow := make(map[string]string)
-		for k, v := range row {
-			updatedRow[k] = v
-		}
-		for k, v := range s.Updates {
-			updatedRow[k] = v
+		// Compute every row before writing any, so that subqueries see
+		// the table as it was
+		updatedRows := make([]db.Row, len(matchingRows))
+		for i, row := range matchingRows {
+			sc.bind(row)
+			updatedRow := row.Clone()
+			for _, a := range s.Set {
+				col := cols[a.Column.Name]
+				newVal, err := evalValue(a.Value, sc)
+				if err != nil {
+					return err
+				}
+				if newVal, err = col.Coerce(newVal); err != nil {
+					return err
+				}
+				if newVal.IsNull() {
+					if col.NotNull {
+						return fmt.Errorf("column '%s' is NOT NULL", a.Column.Name)
+					}
+					delete(updatedRow, a.Column.Name)
+					continue
+				}
+				updatedRow[a.Column.Name] = newVal
+			}
+			updatedRows[i] = updatedRow
 		}
 
-		t.Index.Insert(pkVal, updatedRow)
-		count++
-	}
-
-	if err := t.Save(); err != nil {
+		for _, row := range updatedRows {
+			tx.Put(t, row[pkName].Key(), row)
+			count++
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -499,81 +263,58 @@ func (s *UpdateStmt) Exec(d *db.Database) error {
 }
 
 type DeleteStmt struct {
-	Table string
-	Where *WhereClause
+	Table TableRef
+	Where Expr
 }
 
-func parseDelete(query string) (Statement, error) {
-	queryUpper := strings.ToUpper(query)
-
-	// Check for AND/OR in WHERE clause
-	if strings.Contains(queryUpper, " AND ") || strings.Contains(queryUpper, " OR ") {
-		re := regexp.MustCompile(`(?i)DELETE\s+FROM\s+([a-zA-Z0-9_]+)\s+WHERE\s+(.+?);?$`)
-		m := re.FindStringSubmatch(query)
-		if len(m) < 3 {
-			return nil, errors.New("invalid DELETE syntax with multiple conditions")
-		}
-
-		whereClause, err := parseWhereClause(m[2])
-		if err != nil {
-			return nil, err
-		}
-
-		return &DeleteStmt{
-			Table: m[1],
-			Where: whereClause,
-		}, nil
+func (p *parser) parseDelete() (Statement, error) {
+	if _, err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
 	}
-	// Single condition
-	re := regexp.MustCompile(`(?i)DELETE\s+FROM\s+([a-zA-Z0-9_]+)\s+WHERE\s+([a-zA-Z0-9_]+)\s*=\s*"?([^";]+)"?;?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 4 {
-		return nil, errors.New("invalid DELETE syntax (expected: DELETE FROM table WHERE col=val)")
+	table, err := p.tableRef()
+	if err != nil {
+		return nil, err
 	}
-
-	return &DeleteStmt{
-		Table: m[1],
-		Where: &WhereClause{
-			Conditions: []Condition{{Column: m[2], Operator: "=", Value: m[3]}},
-			Operator:   "AND",
-		},
-	}, nil
+	if _, err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	where, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := noAggregate(where, "WHERE"); err != nil {
+		return nil, err
+	}
+	return &DeleteStmt{Table: table, Where: where}, nil
 }
 
 func (s *DeleteStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
+	if d.Active() == "" {
 		return errors.New("no database selected — use USE <database>")
 	}
 
-	t, err := d.GetTable(s.Table)
-	if err != nil {
-		return err
-	}
+	var count int
+	err := withTx(d, func(tx *db.Tx) error {
+		t, err := d.GetTable(s.Table.Name)
+		if err != nil {
+			return err
+		}
 
-	// Get matching rows
-	allRows := t.SelectAll()
-	var matchingRows []map[string]string
-	for _, row := range allRows {
-		if s.Where.Evaluate(row) {
-			matchingRows = append(matchingRows, row)
+		// Get matching rows
+		sc := newScope(t, newQuery(d, tx))
+		matchingRows, err := filterRows(s.Where, sc, tx.Rows(t))
+		if err != nil {
+			return err
 		}
-	}
 
-	if len(matchingRows) == 0 {
-		fmt.Println("0 row(s) deleted.")
+		pkName := t.PrimaryKey()
+		for _, row := range matchingRows {
+			tx.Delete(t, row[pkName].Key())
+			count++
+		}
 		return nil
-	}
-
-	pkName := t.PrimaryKey()
-	count := 0
-
-	for _, row := range matchingRows {
-		pk := row[pkName]
-		t.Index.Delete(pk)
-		count++
-	}
-
-	if err := t.Save(); err != nil {
+	})
+	if err != nil {
 		return err
 	}
 
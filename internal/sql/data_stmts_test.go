@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+func TestColumnTypes(t *testing.T) {
+	const schema = "CREATE TABLE items (id INT PRIMARY KEY, qty INT, price REAL, label TEXT, ok BOOLEAN)"
+	tests := []struct {
+		stmt  string
+		want  string
+		kinds []db.Kind // kinds of qty, price, label and ok
+		err   string
+	}{
+		{
+			stmt:  "INSERT INTO items (id, qty, price, label, ok) VALUES (1, 3, 2.5, 'a', TRUE)",
+			want:  "1|3|2.5|a|TRUE",
+			kinds: []db.Kind{db.KindInt, db.KindFloat, db.KindText, db.KindBool},
+		},
+		{
+			stmt:  "INSERT INTO items (id, qty, price, label, ok) VALUES ('1', ' 3 ', '2.5', 7, 'yes')",
+			want:  "1|3|2.5|7|TRUE",
+			kinds: []db.Kind{db.KindInt, db.KindFloat, db.KindText, db.KindBool},
+		},
+		{
+			stmt:  "INSERT INTO items (id, qty, price, label, ok) VALUES (1, 4.0, 2, 'a', 0)",
+			want:  "1|4|2.0|a|FALSE",
+			kinds: []db.Kind{db.KindInt, db.KindFloat, db.KindText, db.KindBool},
+		},
+		{
+			stmt:  "INSERT INTO items (id, qty, price, label, ok) VALUES (1, NULL, NULL, NULL, NULL)",
+			want:  "1|NULL|NULL|NULL|NULL",
+			kinds: []db.Kind{db.KindNull, db.KindNull, db.KindNull, db.KindNull},
+		},
+		{
+			stmt: "INSERT INTO items (id, qty) VALUES (1, 'abc')",
+			err:  "column 'qty' expects INT, got TEXT 'abc'",
+		},
+		{
+			stmt: "INSERT INTO items (id, qty) VALUES (1, 2.5)",
+			err:  "column 'qty' expects INT",
+		},
+		{
+			stmt: "INSERT INTO items (id, price) VALUES (1, 'cheap')",
+			err:  "column 'price' expects REAL",
+		},
+		{
+			stmt: "INSERT INTO items (id, ok) VALUES (1, 2)",
+			err:  "column 'ok' expects BOOLEAN",
+		},
+		{
+			stmt: "INSERT INTO items (id, size) VALUES (1, 2)",
+			err:  "column 'size' does not exist",
+		},
+	}
+	for _, tt := range tests {
+		d := openTestDB(t, schema)
+		err := run(d, tt.stmt)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.stmt, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.stmt, err)
+			continue
+		}
+		got, err := selectRows(d, "SELECT * FROM items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.stmt, got, tt.want)
+		}
+		tbl, err := d.GetTable("items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		row, _ := tbl.Index.Get("1")
+		for i, col := range []string{"qty", "price", "label", "ok"} {
+			if k := row[col].Kind(); k != tt.kinds[i] {
+				t.Errorf("%s: %s stored as %s, want %s", tt.stmt, col, k, tt.kinds[i])
+			}
+		}
+	}
+}
+
+func TestUpdateChecksColumnTypes(t *testing.T) {
+	d := openTestDB(t,
+		"CREATE TABLE items (id INT PRIMARY KEY, qty INT NOT NULL)",
+		"INSERT INTO items (id, qty) VALUES (1, 3)",
+	)
+	for _, tt := range []struct {
+		stmt string
+		err  string
+	}{
+		{"UPDATE items SET qty = 'abc' WHERE id = 1", "column 'qty' expects INT, got TEXT 'abc'"},
+		{"UPDATE items SET qty = NULL WHERE id = 1", "column 'qty' is NOT NULL"},
+		{"UPDATE items SET id = 2 WHERE id = 1", "cannot update PRIMARY KEY column 'id'"},
+		{"UPDATE items SET size = 2 WHERE id = 1", "column 'size' does not exist"},
+	} {
+		if err := run(d, tt.stmt); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.stmt, err, tt.err)
+		}
+	}
+
+	exec(t, d, "UPDATE items SET qty = '8' WHERE id = 1")
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT qty FROM items", want: []string{"8"}},
+	})
+}
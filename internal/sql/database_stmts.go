@@ -1,9 +1,7 @@
 package sql
 
 import (
-	"errors"
 	"fmt"
-	"regexp"
 
 	"github.com/abmcmanu/go-mini-sqlite/internal/db"
 )
@@ -12,13 +10,12 @@ type CreateDatabaseStmt struct {
 	Name string
 }
 
-func parseCreateDatabase(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)CREATE\s+DATABASE\s+([a-zA-Z0-9_]+);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid CREATE DATABASE syntax")
+func (p *parser) parseCreateDatabase() (Statement, error) {
+	name, err := p.ident("a database name")
+	if err != nil {
+		return nil, err
 	}
-	return &CreateDatabaseStmt{Name: m[1]}, nil
+	return &CreateDatabaseStmt{Name: name.Text}, nil
 }
 
 func (s *CreateDatabaseStmt) Exec(d *db.Database) error {
@@ -29,13 +26,12 @@ type DropDatabaseStmt struct {
 	Name string
 }
 
-func parseDropDatabase(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)DROP\s+DATABASE\s+([a-zA-Z0-9_]+);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid DROP DATABASE syntax")
+func (p *parser) parseDropDatabase() (Statement, error) {
+	name, err := p.ident("a database name")
+	if err != nil {
+		return nil, err
 	}
-	return &DropDatabaseStmt{Name: m[1]}, nil
+	return &DropDatabaseStmt{Name: name.Text}, nil
 }
 
 func (s *DropDatabaseStmt) Exec(d *db.Database) error {
@@ -49,14 +45,6 @@ func (s *DropDatabaseStmt) Exec(d *db.Database) error {
 
 type ShowDatabasesStmt struct{}
 
-func parseShowDatabases(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)SHOW\s+DATABASES;?`)
-	if !re.MatchString(query) {
-		return nil, errors.New("invalid SHOW DATABASES syntax")
-	}
-	return &ShowDatabasesStmt{}, nil
-}
-
 func (s *ShowDatabasesStmt) Exec(d *db.Database) error {
 	databases, err := d.ListDatabases()
 	if err != nil {
@@ -79,13 +67,12 @@ type UseDatabaseStmt struct {
 	Name string
 }
 
-func parseUseDatabase(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)USE\s+([a-zA-Z0-9_]+);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid USE syntax")
+func (p *parser) parseUseDatabase() (Statement, error) {
+	name, err := p.ident("a database name")
+	if err != nil {
+		return nil, err
 	}
-	return &UseDatabaseStmt{Name: m[1]}, nil
+	return &UseDatabaseStmt{Name: name.Text}, nil
 }
 
 func (s *UseDatabaseStmt) Exec(d *db.Database) error {
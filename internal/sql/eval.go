@@ -0,0 +1,673 @@
+package sql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// scope is what expressions are evaluated against: the current row of
+// each table of the FROM clause, along with the table schemas. When rows
+// are grouped, the rows are those of one row of the group and aggs holds
+// the aggregates computed over the group. windows holds the values of the
+// window functions at the row.
+//
+// In a subquery, outer is the scope of the enclosing query: its columns
+// can be used too, and correlated is then set.
+type scope struct {
+	tables     []*tableScope
+	aggs       map[*AggregateCall]db.Value
+	windows    map[Expr]db.Value
+	q          *query
+	outer      *scope
+	correlated *bool
+}
+
+// tableScope is a table of a scope, named by its alias or its name. row is
+// nil on the NULL side of a LEFT JOIN, making every column NULL.
+type tableScope struct {
+	name   string
+	cols   []db.Column
+	byName map[string]db.Column
+	row    db.Row
+}
+
+func newTableScope(name string, schema db.Schema) *tableScope {
+	return &tableScope{name: name, cols: schema.Columns, byName: schema.ColumnsMap()}
+}
+
+func newScope(t *db.Table, q *query) *scope {
+	return &scope{tables: []*tableScope{newTableScope(t.Name, t.Schema)}, q: q}
+}
+
+// bind sets the current rows, one per table, in order.
+func (sc *scope) bind(rows ...db.Row) {
+	for i, ts := range sc.tables {
+		ts.row = rows[i]
+	}
+}
+
+// with returns a copy of sc bound to rows, which keeps them.
+func (sc *scope) with(rows []db.Row) *scope {
+	c := sc.prefix(0)
+	for i, ts := range sc.tables {
+		t := *ts
+		t.row = rows[i]
+		c.tables = append(c.tables, &t)
+	}
+	return c
+}
+
+// prefix returns a scope with the first n tables of sc.
+func (sc *scope) prefix(n int) *scope {
+	return &scope{tables: sc.tables[:n:n], q: sc.q, outer: sc.outer, correlated: sc.correlated}
+}
+
+// column finds the table and the column named by ref.
+func (sc *scope) column(ref *ColumnRef) (*tableScope, db.Column, error) {
+	var found *tableScope
+	var col db.Column
+	knownTable := ref.Table == ""
+	for _, ts := range sc.tables {
+		if ref.Table != "" && ts.name != ref.Table {
+			continue
+		}
+		knownTable = true
+		c, ok := ts.byName[ref.Name]
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, db.Column{}, fmt.Errorf("%s: column '%s' is ambiguous", ref.Pos, ref.Name)
+		}
+		found, col = ts, c
+	}
+	if found != nil {
+		return found, col, nil
+	}
+	if sc.outer != nil {
+		if ts, col, err := sc.outer.column(ref); err == nil {
+			*sc.correlated = true
+			return ts, col, nil
+		}
+	}
+	if !knownTable {
+		return nil, db.Column{}, fmt.Errorf("%s: unknown table '%s'", ref.Pos, ref.Table)
+	}
+	return nil, db.Column{}, fmt.Errorf("column '%s' does not exist", exprText(ref))
+}
+
+// checkColumns reports the first column used by e that sc does not have.
+func checkColumns(e Expr, sc *scope) error {
+	var err error
+	walk(e, func(e Expr) {
+		if ref, ok := e.(*ColumnRef); ok && err == nil {
+			_, _, err = sc.column(ref)
+		}
+	})
+	return err
+}
+
+// truth is the value of a condition under SQL three-valued logic: a
+// comparison involving NULL is unknown, and only true conditions match.
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	}
+	return truthUnknown
+}
+
+// and combines t and u as AND does: false wins over unknown.
+func (t truth) and(u truth) truth {
+	switch {
+	case t == truthFalse || u == truthFalse:
+		return truthFalse
+	case t == truthUnknown || u == truthUnknown:
+		return truthUnknown
+	}
+	return truthTrue
+}
+
+// matches reports whether the row of sc satisfies a WHERE condition. A
+// nil condition matches every row.
+func matches(cond Expr, sc *scope) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+	t, err := evalBool(cond, sc)
+	return t == truthTrue, err
+}
+
+// filterRows returns the rows satisfying cond, of the single table of sc.
+func filterRows(cond Expr, sc *scope, rows []db.Row) ([]db.Row, error) {
+	var matching []db.Row
+	for _, row := range rows {
+		sc.bind(row)
+		ok, err := matches(cond, sc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, row)
+		}
+	}
+	return matching, nil
+}
+
+// evalBool evaluates a condition. An expression that is not a predicate
+// must have a BOOLEAN value; NULL is unknown.
+func evalBool(e Expr, sc *scope) (truth, error) {
+	switch e := e.(type) {
+	case *UnaryExpr:
+		if e.Op == "NOT" {
+			t, err := evalBool(e.Operand, sc)
+			return t.not(), err
+		}
+
+	case *BinaryExpr:
+		switch e.Op {
+		case "AND", "OR":
+			// The left side decides alone when it is false for AND, true for OR
+			decisive := truthOf(e.Op == "OR")
+			left, err := evalBool(e.Left, sc)
+			if err != nil || left == decisive {
+				return left, err
+			}
+			right, err := evalBool(e.Right, sc)
+			if err != nil || right == decisive {
+				return right, err
+			}
+			if left == truthUnknown || right == truthUnknown {
+				return truthUnknown, nil
+			}
+			return left, nil
+		case "LIKE":
+			value, err := evalValue(e.Left, sc)
+			if err != nil {
+				return truthFalse, err
+			}
+			pattern, err := evalValue(e.Right, sc)
+			if err != nil || value.IsNull() || pattern.IsNull() {
+				return truthUnknown, err
+			}
+			return truthOf(matchPattern(value.String(), pattern.String())), nil
+		case "=", "<>", "<", "<=", ">", ">=":
+			return evalComparison(e, sc)
+		}
+
+	case *InExpr:
+		if e.Query != nil {
+			return evalInSubquery(e, sc)
+		}
+		// x IN (a, b) is x = a OR x = b
+		result := truthFalse
+		for _, item := range e.List {
+			cmp, ok, err := compare(e.Expr, item, sc)
+			if err != nil {
+				return truthFalse, err
+			}
+			if !ok {
+				result = truthUnknown
+			} else if cmp == 0 {
+				result = truthTrue
+				break
+			}
+		}
+		if e.Not {
+			return result.not(), nil
+		}
+		return result, nil
+
+	case *BetweenExpr:
+		// x BETWEEN a AND b is x >= a AND x <= b, either side unknown
+		// with a NULL
+		low, ok, err := compare(e.Expr, e.Low, sc)
+		if err != nil {
+			return truthFalse, err
+		}
+		aboveLow := truthUnknown
+		if ok {
+			aboveLow = truthOf(low >= 0)
+		}
+		high, ok, err := compare(e.Expr, e.High, sc)
+		if err != nil {
+			return truthFalse, err
+		}
+		belowHigh := truthUnknown
+		if ok {
+			belowHigh = truthOf(high <= 0)
+		}
+		result := aboveLow.and(belowHigh)
+		if e.Not {
+			return result.not(), nil
+		}
+		return result, nil
+
+	case *IsNullExpr:
+		v, err := evalValue(e.Expr, sc)
+		return truthOf(v.IsNull() != e.Not), err
+
+	case *ExistsExpr:
+		res, err := subqueryResult(e.Query, e.Pos, sc)
+		if err != nil {
+			return truthFalse, err
+		}
+		return truthOf(len(res.rows) > 0), nil
+	}
+
+	v, err := evalValue(e, sc)
+	switch {
+	case err != nil:
+		return truthFalse, err
+	case v.IsNull():
+		return truthUnknown, nil
+	case v.Kind() == db.KindBool:
+		return truthOf(v.Bool()), nil
+	}
+	return truthFalse, fmt.Errorf("%s: expected a condition, got %s %s", e.Position(), v.Kind(), v)
+}
+
+// evalValue returns the value of an expression. A condition is a BOOLEAN,
+// or NULL when unknown.
+func evalValue(e Expr, sc *scope) (db.Value, error) {
+	switch e := e.(type) {
+	case *Literal:
+		return literalValue(e)
+	case *BinaryExpr:
+		switch e.Op {
+		case "+", "-", "*", "/", "%":
+			return evalArithmetic(e, sc)
+		case "||":
+			return evalConcat(e, sc)
+		}
+		return conditionValue(e, sc)
+	case *UnaryExpr:
+		if e.Op == "-" {
+			return evalNegate(e, sc)
+		}
+		return conditionValue(e, sc)
+	case *InExpr, *BetweenExpr, *IsNullExpr, *ExistsExpr:
+		return conditionValue(e, sc)
+	case *SubqueryExpr:
+		return evalScalarSubquery(e, sc)
+	case *ColumnRef:
+		if sc == nil {
+			return db.Value{}, fmt.Errorf("column '%s' cannot be used here", e.Name)
+		}
+		ts, _, err := sc.column(e)
+		if err != nil {
+			return db.Value{}, err
+		}
+		return ts.row[e.Name], nil
+	case *FuncCall:
+		return evalFunc(e, sc)
+	case *AggregateCall:
+		if sc != nil {
+			if v, ok := sc.aggs[e]; ok {
+				return v, nil
+			}
+			if v, ok := sc.windows[e]; ok {
+				return v, nil
+			}
+		}
+		return db.Value{}, fmt.Errorf("%s: aggregate function %s cannot be used here", e.Pos, e.Name)
+	case *WindowCall:
+		if sc != nil {
+			if v, ok := sc.windows[e]; ok {
+				return v, nil
+			}
+		}
+		return db.Value{}, fmt.Errorf("%s: window function %s cannot be used here", e.Pos, e.Name)
+	case *ExtractExpr:
+		return evalExtract(e, sc)
+	case *IntervalExpr:
+		return db.Value{}, fmt.Errorf("%s: INTERVAL can only be used in DATE_ADD and DATE_SUB", e.Pos)
+	}
+	return db.Value{}, fmt.Errorf("%s: expected a value", e.Position())
+}
+
+// conditionValue returns the value of a condition.
+func conditionValue(e Expr, sc *scope) (db.Value, error) {
+	t, err := evalBool(e, sc)
+	if err != nil || t == truthUnknown {
+		return db.Null(), err
+	}
+	return db.Bool(t == truthTrue), nil
+}
+
+// literalValue returns the value written by a literal: numbers with a
+// fraction or an exponent are FLOAT, other numbers INT.
+func literalValue(e *Literal) (db.Value, error) {
+	switch e.Kind {
+	case LitNull:
+		return db.Null(), nil
+	case LitString:
+		return db.Text(e.Value), nil
+	case LitBool:
+		return db.Bool(e.Value == "TRUE"), nil
+	case LitBlob:
+		b, err := hex.DecodeString(e.Value)
+		if err != nil {
+			return db.Value{}, fmt.Errorf("%s: invalid blob X'%s'", e.Pos, e.Value)
+		}
+		return db.Blob(b), nil
+	}
+	if i, err := strconv.ParseInt(e.Value, 10, 64); err == nil {
+		return db.Int(i), nil
+	}
+	f, err := strconv.ParseFloat(e.Value, 64)
+	if err != nil {
+		return db.Value{}, fmt.Errorf("%s: invalid number %s", e.Pos, e.Value)
+	}
+	return db.Float(f), nil
+}
+
+// evalComparison evaluates =, <>, <, <=, > and >=.
+func evalComparison(e *BinaryExpr, sc *scope) (truth, error) {
+	cmp, ok, err := compare(e.Left, e.Right, sc)
+	if err != nil || !ok {
+		return truthUnknown, err
+	}
+
+	switch e.Op {
+	case "=":
+		return truthOf(cmp == 0), nil
+	case "<>":
+		return truthOf(cmp != 0), nil
+	case "<":
+		return truthOf(cmp < 0), nil
+	case "<=":
+		return truthOf(cmp <= 0), nil
+	case ">":
+		return truthOf(cmp > 0), nil
+	case ">=":
+		return truthOf(cmp >= 0), nil
+	}
+	return truthFalse, fmt.Errorf("%s: unknown operator %s", e.Pos, e.Op)
+}
+
+// compare compares the values of two expressions. A text compared with a
+// number is read as a number: a literal that is not one is an error, a
+// malformed value of an INT column (kept from an older file) makes the
+// comparison unknown, and other texts are compared as text. ok is false when
+// a value is NULL, which makes the comparison unknown.
+func compare(left, right Expr, sc *scope) (cmp int, ok bool, err error) {
+	l, err := evalValue(left, sc)
+	if err != nil {
+		return 0, false, err
+	}
+	r, err := evalValue(right, sc)
+	if err != nil {
+		return 0, false, err
+	}
+	return compareValues(l, r, left, right, sc)
+}
+
+// compareValues compares the values l and r of expressions left and right
+// as compare does.
+func compareValues(l, r db.Value, left, right Expr, sc *scope) (cmp int, ok bool, err error) {
+	if l.IsNull() || r.IsNull() {
+		return 0, false, nil
+	}
+
+	ok = true
+	switch {
+	case l.IsNumber() && r.Kind() == db.KindText:
+		r, ok, err = textAsNumber(r, right, left, sc)
+	case r.IsNumber() && l.Kind() == db.KindText:
+		l, ok, err = textAsNumber(l, left, right, sc)
+	case l.Kind() == db.KindBool && r.Kind() != db.KindBool:
+		r, err = asBool(r, right)
+	case r.Kind() == db.KindBool && l.Kind() != db.KindBool:
+		l, err = asBool(l, left)
+	case l.IsTemporal() && r.Kind() == db.KindText:
+		r, err = asTemporal(r, l.Kind(), right)
+	case r.IsTemporal() && l.Kind() == db.KindText:
+		l, err = asTemporal(l, r.Kind(), left)
+	}
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	if cmp, ok := db.Compare(l, r); ok {
+		return cmp, true, nil
+	}
+	if (l.Kind() == db.KindText || r.Kind() == db.KindText) && l.Kind() != db.KindBlob && r.Kind() != db.KindBlob {
+		return strings.Compare(l.String(), r.String()), true, nil
+	}
+	return 0, false, fmt.Errorf("%s: cannot compare %s with %s", left.Position(), l.Kind(), r.Kind())
+}
+
+// textAsNumber reads the text value v of expression e as a number, to be
+// compared with the value of expression other. ok is false when v is a
+// malformed value of an INT column.
+func textAsNumber(v db.Value, e, other Expr, sc *scope) (n db.Value, ok bool, err error) {
+	if f, err := parseNumber(v.String()); err == nil {
+		return db.Float(f), true, nil
+	}
+	switch e := e.(type) {
+	case *Literal:
+		if ref, isCol := other.(*ColumnRef); isCol && sc != nil {
+			_, col, _ := sc.column(ref)
+			return v, false, fmt.Errorf("%s: invalid %s value '%s' for column '%s'", e.Pos, col.TypeName(), v, col.Name)
+		}
+		return v, false, fmt.Errorf("%s: '%s' is not a number", e.Pos, v)
+	case *ColumnRef:
+		if _, col, _ := sc.column(e); col.Type == db.TypeInt {
+			return v, false, nil
+		}
+	}
+	return v, true, nil
+}
+
+// asBool converts the value v of expression e, compared with a boolean, to
+// a boolean: 1 and 0 or a text such as 'true' or 'no'.
+func asBool(v db.Value, e Expr) (db.Value, error) {
+	b, err := db.Column{Type: db.TypeBool}.Coerce(v)
+	if err != nil {
+		return v, fmt.Errorf("%s: cannot compare %s %s with a BOOLEAN", e.Position(), v.Kind(), v)
+	}
+	return b, nil
+}
+
+// asTemporal reads the text value v of expression e, compared with a date
+// or time of the given kind, as a value of that kind. A literal that is
+// not one is an error; other texts are compared as text.
+func asTemporal(v db.Value, kind db.Kind, e Expr) (db.Value, error) {
+	if t, ok := db.ParseTemporal(v.String(), kind); ok {
+		return t, nil
+	}
+	if _, isLit := e.(*Literal); isLit {
+		return v, fmt.Errorf("%s: invalid %s '%s'", e.Position(), kind, v)
+	}
+	return v, nil
+}
+
+// evalArithmetic evaluates +, -, *, / and %. NULL makes the result NULL.
+// Integers give an integer (division truncates), a FLOAT operand a FLOAT,
+// and DECIMAL operands an exact DECIMAL: its scale is the larger one for
+// +, - and %, the sum of both for *, and 4 more digits for /.
+func evalArithmetic(e *BinaryExpr, sc *scope) (db.Value, error) {
+	l, err := evalValue(e.Left, sc)
+	if err != nil {
+		return db.Value{}, err
+	}
+	r, err := evalValue(e.Right, sc)
+	if err != nil || l.IsNull() || r.IsNull() {
+		return db.Null(), err
+	}
+	if l, err = numericOperand(l, e.Left); err != nil {
+		return db.Value{}, err
+	}
+	if r, err = numericOperand(r, e.Right); err != nil {
+		return db.Value{}, err
+	}
+
+	if (e.Op == "/" || e.Op == "%") && r.Rat().Sign() == 0 {
+		return db.Value{}, fmt.Errorf("%s: division by zero", e.Pos)
+	}
+
+	switch {
+	case l.Kind() == db.KindInt && r.Kind() == db.KindInt:
+		a, b := l.Int(), r.Int()
+		var n int64
+		switch e.Op {
+		case "+":
+			n = a + b
+			if (n > a) != (b > 0) {
+				return db.Value{}, fmt.Errorf("%s: integer overflow", e.Pos)
+			}
+		case "-":
+			n = a - b
+			if (n < a) != (b > 0) {
+				return db.Value{}, fmt.Errorf("%s: integer overflow", e.Pos)
+			}
+		case "*":
+			n = a * b
+			if a != 0 && (n/a != b || a == -1 && b == math.MinInt64) {
+				return db.Value{}, fmt.Errorf("%s: integer overflow", e.Pos)
+			}
+		case "/":
+			if a == math.MinInt64 && b == -1 {
+				return db.Value{}, fmt.Errorf("%s: integer overflow", e.Pos)
+			}
+			n = a / b
+		case "%":
+			n = a % b
+		}
+		return db.Int(n), nil
+
+	case l.Kind() == db.KindFloat || r.Kind() == db.KindFloat:
+		a, b := l.Float(), r.Float()
+		switch e.Op {
+		case "+":
+			return db.Float(a + b), nil
+		case "-":
+			return db.Float(a - b), nil
+		case "*":
+			return db.Float(a * b), nil
+		case "%":
+			return db.Float(math.Mod(a, b)), nil
+		}
+		return db.Float(a / b), nil
+	}
+
+	a, b := l.Rat(), r.Rat()
+	n := new(big.Rat)
+	scale := max(l.Scale(), r.Scale())
+	switch e.Op {
+	case "+":
+		n.Add(a, b)
+	case "-":
+		n.Sub(a, b)
+	case "*":
+		n.Mul(a, b)
+		scale = l.Scale() + r.Scale()
+	case "/":
+		n.Quo(a, b)
+		scale += 4
+	case "%":
+		// a - b * trunc(a / b), which has the sign of a
+		q := new(big.Int).Quo(new(big.Int).Mul(a.Num(), b.Denom()), new(big.Int).Mul(a.Denom(), b.Num()))
+		n.Sub(a, new(big.Rat).Mul(b, new(big.Rat).SetInt(q)))
+	}
+	return decimalResult(n, scale, e.Pos)
+}
+
+// decimalResult returns n as a DECIMAL with the given scale.
+func decimalResult(n *big.Rat, scale int, pos Pos) (db.Value, error) {
+	v, err := db.DecimalFromRat(n, db.MaxDecimalPrecision, min(scale, db.MaxDecimalPrecision))
+	if err != nil {
+		return db.Value{}, fmt.Errorf("%s: %v", pos, err)
+	}
+	return v, nil
+}
+
+// evalNegate evaluates unary minus.
+func evalNegate(e *UnaryExpr, sc *scope) (db.Value, error) {
+	v, err := evalValue(e.Operand, sc)
+	if err != nil || v.IsNull() {
+		return db.Null(), err
+	}
+	if v, err = numericOperand(v, e.Operand); err != nil {
+		return db.Value{}, err
+	}
+	switch v.Kind() {
+	case db.KindInt:
+		if v.Int() == math.MinInt64 {
+			return db.Value{}, fmt.Errorf("%s: integer overflow", e.Pos)
+		}
+		return db.Int(-v.Int()), nil
+	case db.KindFloat:
+		return db.Float(-v.Float()), nil
+	}
+	return decimalResult(new(big.Rat).Neg(v.Rat()), v.Scale(), e.Pos)
+}
+
+// evalConcat evaluates ||, which joins the texts of its operands; NULL
+// makes the result NULL and two blobs give a blob.
+func evalConcat(e *BinaryExpr, sc *scope) (db.Value, error) {
+	l, err := evalValue(e.Left, sc)
+	if err != nil {
+		return db.Value{}, err
+	}
+	r, err := evalValue(e.Right, sc)
+	if err != nil || l.IsNull() || r.IsNull() {
+		return db.Null(), err
+	}
+	if l.Kind() == db.KindBlob && r.Kind() == db.KindBlob {
+		return db.Blob(append(l.Bytes(), r.Bytes()...)), nil
+	}
+	return db.Text(concatText(l) + concatText(r)), nil
+}
+
+// concatText returns the text of a value joined by ||: a blob gives its
+// bytes.
+func concatText(v db.Value) string {
+	if v.Kind() == db.KindBlob {
+		return string(v.Bytes())
+	}
+	return v.String()
+}
+
+// numericOperand returns the value v of the operand e of an arithmetic
+// operator as a number; a text holding a number is read as one.
+func numericOperand(v db.Value, e Expr) (db.Value, error) {
+	if v.IsNumber() {
+		return v, nil
+	}
+	if v.Kind() == db.KindText {
+		s := strings.TrimSpace(v.String())
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return db.Int(i), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return db.Float(f), nil
+		}
+		return v, fmt.Errorf("%s: '%s' is not a number", e.Position(), v)
+	}
+	return v, fmt.Errorf("%s: expected a number, got %s %s", e.Position(), v.Kind(), v)
+}
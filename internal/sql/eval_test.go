@@ -0,0 +1,59 @@
+package sql
+
+import "testing"
+
+// usersSchema is the table most expression tests read.
+var usersSchema = []string{
+	"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, city TEXT, age INT)",
+	"INSERT INTO users (id, name, city, age) VALUES (1, 'ann', 'Paris', 30)",
+	"INSERT INTO users (id, name, city, age) VALUES (2, 'bob', 'Lyon', 25)",
+	"INSERT INTO users (id, name, city, age) VALUES (3, 'cat', 'Paris', NULL)",
+	"INSERT INTO users (id, name, city, age) VALUES (4, 'dan', NULL, 41)",
+}
+
+func TestPredicates(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT id FROM users WHERE city IN ('Lyon', 'Nice')", want: []string{"2"}},
+		{query: "SELECT id FROM users WHERE city NOT IN ('Lyon')", want: []string{"1", "3"}},
+		{query: "SELECT id FROM users WHERE city NOT IN ('Lyon', NULL)", want: nil},
+		{query: "SELECT id FROM users WHERE age BETWEEN 25 AND 30", want: []string{"1", "2"}},
+		{query: "SELECT id FROM users WHERE age NOT BETWEEN 25 AND 30", want: []string{"4"}},
+		{query: "SELECT id FROM users WHERE age IS NULL", want: []string{"3"}},
+		{query: "SELECT id FROM users WHERE city IS NOT NULL AND age IS NOT NULL", want: []string{"1", "2"}},
+		{query: "SELECT id FROM users WHERE (city = 'Paris' OR city = 'Lyon') AND NOT age < 30", want: []string{"1"}},
+
+		// One unknown bound makes BETWEEN unknown only when the other
+		// bound does not already decide it.
+		{query: "SELECT 5 BETWEEN NULL AND 3 FROM users WHERE id = 1", want: []string{"FALSE"}},
+		{query: "SELECT 5 NOT BETWEEN NULL AND 3 FROM users WHERE id = 1", want: []string{"TRUE"}},
+		{query: "SELECT 2 BETWEEN NULL AND 3 FROM users WHERE id = 1", want: []string{"NULL"}},
+		{query: "SELECT 2 NOT BETWEEN NULL AND 3 FROM users WHERE id = 1", want: []string{"NULL"}},
+		{query: "SELECT 0 BETWEEN 1 AND NULL FROM users WHERE id = 1", want: []string{"FALSE"}},
+		{query: "SELECT id FROM users WHERE 5 NOT BETWEEN NULL AND 3 AND id < 3", want: []string{"1", "2"}},
+	})
+}
+
+func TestExpressions(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT 1 + 2 * 3, (1 + 2) * 3, 7 / 2, 7 % 3, -age FROM users WHERE id = 1", want: []string{"7|9|3|1|-30"}},
+		{query: "SELECT 7.0 / 2, 1 - 0.25 FROM users WHERE id = 1", want: []string{"3.5|0.75"}},
+		{query: "SELECT name || ' of ' || city FROM users WHERE id = 1", want: []string{"ann of Paris"}},
+		{query: "SELECT name || city, age + 1 FROM users WHERE id = 3", want: []string{"catParis|NULL"}},
+		{query: "SELECT id FROM users WHERE age * 2 > 55", want: []string{"1", "4"}},
+		{query: "SELECT name FROM users WHERE age IS NOT NULL ORDER BY age % 10, id", want: []string{"ann", "dan", "bob"}},
+		{query: "SELECT 1 / 0 FROM users WHERE id = 1", err: "division by zero"},
+		{query: "SELECT 1 % 0 FROM users WHERE id = 1", err: "division by zero"},
+		{query: "SELECT nope(1) FROM users", err: "nope"},
+		{query: "SELECT missing + 1 FROM users", err: "column 'missing' does not exist"},
+	})
+
+	exec(t, d,
+		"UPDATE users SET age = age + 1 WHERE city = 'Paris'",
+		"UPDATE users SET name = name || '!' WHERE age > 40",
+	)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT name, age FROM users", want: []string{"ann|31", "bob|25", "cat|NULL", "dan!|41"}},
+	})
+}
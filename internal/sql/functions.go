@@ -0,0 +1,322 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// function is a scalar function callable in expressions. Its arguments are
+// evaluated before the call; an INTERVAL argument is passed as its count.
+// A NULL argument makes the result NULL.
+type function struct {
+	minArgs, maxArgs int // maxArgs is -1 when unbounded
+	eval             func(call *FuncCall, args []db.Value) (db.Value, error)
+}
+
+func (f function) arity() string {
+	return arity(f.minArgs, f.maxArgs)
+}
+
+// arity describes how many arguments a function takes.
+func arity(minArgs, maxArgs int) string {
+	switch {
+	case minArgs == maxArgs && minArgs == 0:
+		return "no arguments"
+	case minArgs == maxArgs && minArgs == 1:
+		return "1 argument"
+	case minArgs == maxArgs:
+		return fmt.Sprintf("%d arguments", minArgs)
+	case maxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+}
+
+var functions = map[string]function{
+	"NOW":               {0, 0, fnNow},
+	"CURRENT_TIMESTAMP": {0, 0, fnNow},
+	"CURRENT_DATE":      {0, 0, fnCurrentDate},
+	"CURDATE":           {0, 0, fnCurrentDate},
+	"CURRENT_TIME":      {0, 0, fnCurrentTime},
+	"CURTIME":           {0, 0, fnCurrentTime},
+	"DATE":              {1, 1, temporalCast(db.KindDate)},
+	"TIME":              {1, 1, temporalCast(db.KindTime)},
+	"DATETIME":          {1, 1, temporalCast(db.KindTimestamp)},
+	"STRFTIME":          {2, 2, fnStrftime},
+	"DATE_ADD":          {2, 2, dateAdd(1)},
+	"DATE_SUB":          {2, 2, dateAdd(-1)},
+}
+
+// niladic lists the functions that may be called without parentheses.
+var niladic = map[string]bool{
+	"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+}
+
+// clock returns the current time; dates and times are in UTC.
+var clock = time.Now
+
+// evalFunc evaluates the arguments of a function call, then the call.
+func evalFunc(call *FuncCall, sc *scope) (db.Value, error) {
+	fn := functions[call.Name]
+	args := make([]db.Value, len(call.Args))
+	for i, arg := range call.Args {
+		if iv, ok := arg.(*IntervalExpr); ok {
+			arg = iv.Value
+		}
+		v, err := evalValue(arg, sc)
+		if err != nil {
+			return db.Value{}, err
+		}
+		if v.IsNull() {
+			return db.Null(), nil
+		}
+		args[i] = v
+	}
+	return fn.eval(call, args)
+}
+
+func fnNow(*FuncCall, []db.Value) (db.Value, error) {
+	return db.Timestamp(clock().UTC().Truncate(time.Second)), nil
+}
+
+func fnCurrentDate(*FuncCall, []db.Value) (db.Value, error) {
+	return db.Date(clock().UTC()), nil
+}
+
+func fnCurrentTime(*FuncCall, []db.Value) (db.Value, error) {
+	now := db.Timestamp(clock().UTC().Truncate(time.Second))
+	return db.TimeOfDay(now.Clock()), nil
+}
+
+// temporalArg converts a function argument to a date or time of the given
+// kind; the text 'now' is the current time.
+func temporalArg(call *FuncCall, v db.Value, kind db.Kind) (db.Value, error) {
+	if v.Kind() == db.KindText && strings.EqualFold(strings.TrimSpace(v.String()), "now") {
+		v = db.Timestamp(clock().UTC())
+	}
+	if v.Kind() == kind {
+		return v, nil
+	}
+	t, err := db.Column{Name: call.Name, Type: temporalTypes[kind]}.Coerce(v)
+	if err != nil {
+		return db.Value{}, fmt.Errorf("%s: %s expects a %s, got %s '%s'", call.Pos, call.Name, kind, v.Kind(), v)
+	}
+	return t, nil
+}
+
+var temporalTypes = map[db.Kind]db.ColType{
+	db.KindDate:      db.TypeDate,
+	db.KindTime:      db.TypeTime,
+	db.KindTimestamp: db.TypeTimestamp,
+}
+
+// anyTemporalArg converts a function argument to a date or a time: texts
+// are read as a date, a timestamp or a time of day, whichever fits.
+func anyTemporalArg(call *FuncCall, v db.Value) (db.Value, error) {
+	if v.IsTemporal() {
+		return v, nil
+	}
+	if v.Kind() == db.KindText {
+		for _, kind := range []db.Kind{db.KindDate, db.KindTimestamp, db.KindTime} {
+			if t, ok := db.ParseTemporal(v.String(), kind); ok {
+				return t, nil
+			}
+		}
+	}
+	return temporalArg(call, v, db.KindTimestamp)
+}
+
+// temporalCast returns DATE(x), TIME(x) or DATETIME(x).
+func temporalCast(kind db.Kind) func(*FuncCall, []db.Value) (db.Value, error) {
+	return func(call *FuncCall, args []db.Value) (db.Value, error) {
+		return temporalArg(call, args[0], kind)
+	}
+}
+
+// fnStrftime formats a date or time as SQLite does: %Y year, %m month, %d
+// day, %H hour, %M minute, %S seconds, %f seconds with milliseconds,
+// %j day of the year, %w day of the week (0 is Sunday), %s Unix time, %%.
+func fnStrftime(call *FuncCall, args []db.Value) (db.Value, error) {
+	format := args[0].String()
+	v, err := anyTemporalArg(call, args[1])
+	if err != nil {
+		return db.Value{}, err
+	}
+	t := v.Time()
+	if v.Kind() == db.KindTime {
+		t = time.Unix(0, 0).UTC().Add(v.Clock())
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'f':
+			fmt.Fprintf(&b, "%06.3f", float64(t.Second())+float64(t.Nanosecond())/1e9)
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'w':
+			fmt.Fprintf(&b, "%d", int(t.Weekday()))
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case '%':
+			b.WriteByte('%')
+		default:
+			return db.Value{}, fmt.Errorf("%s: unknown STRFTIME format %%%c", call.Pos, format[i])
+		}
+	}
+	return db.Text(b.String()), nil
+}
+
+// intervalUnits lists the units of an INTERVAL.
+var intervalUnits = map[string]bool{
+	"MICROSECOND": true, "SECOND": true, "MINUTE": true, "HOUR": true,
+	"DAY": true, "WEEK": true, "MONTH": true, "QUARTER": true, "YEAR": true,
+}
+
+var unitDurations = map[string]time.Duration{
+	"MICROSECOND": time.Microsecond,
+	"SECOND":      time.Second,
+	"MINUTE":      time.Minute,
+	"HOUR":        time.Hour,
+}
+
+// dateAdd returns DATE_ADD (sign 1) or DATE_SUB (sign -1). A DATE stays a
+// DATE unless the interval is shorter than a day, and adding months to the
+// 31st clamps to the end of the month (2024-01-31 + 1 MONTH = 2024-02-29).
+func dateAdd(sign int) func(*FuncCall, []db.Value) (db.Value, error) {
+	return func(call *FuncCall, args []db.Value) (db.Value, error) {
+		iv, ok := call.Args[1].(*IntervalExpr)
+		if !ok {
+			return db.Value{}, fmt.Errorf("%s: %s expects an INTERVAL", call.Args[1].Position(), call.Name)
+		}
+		n, err := db.Column{Name: "INTERVAL", Type: db.TypeInt}.Coerce(args[1])
+		if err != nil {
+			return db.Value{}, fmt.Errorf("%s: INTERVAL expects a whole number, got %s '%s'", iv.Pos, args[1].Kind(), args[1])
+		}
+		count := int(n.Int()) * sign
+
+		v, err := anyTemporalArg(call, args[0])
+		if err != nil {
+			return db.Value{}, err
+		}
+
+		if d, subDay := unitDurations[iv.Unit]; subDay {
+			shift := time.Duration(count) * d
+			if v.Kind() == db.KindTime {
+				return db.TimeOfDay(v.Clock() + shift), nil
+			}
+			return db.Timestamp(v.Time().Add(shift)), nil
+		}
+		if v.Kind() == db.KindTime {
+			return db.Value{}, fmt.Errorf("%s: cannot add %s to a TIME", iv.Pos, iv.Unit)
+		}
+
+		t := v.Time()
+		switch iv.Unit {
+		case "DAY":
+			t = t.AddDate(0, 0, count)
+		case "WEEK":
+			t = t.AddDate(0, 0, 7*count)
+		case "MONTH":
+			t = addMonths(t, count)
+		case "QUARTER":
+			t = addMonths(t, 3*count)
+		case "YEAR":
+			t = addMonths(t, 12*count)
+		}
+		if v.Kind() == db.KindDate {
+			return db.Date(t), nil
+		}
+		return db.Timestamp(t), nil
+	}
+}
+
+// addMonths adds months to t, keeping the day within the resulting month.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	first = first.AddDate(0, months, 0)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+// extractFields lists the fields EXTRACT accepts.
+var extractFields = map[string]bool{
+	"YEAR": true, "QUARTER": true, "MONTH": true, "WEEK": true, "DAY": true,
+	"DOW": true, "DOY": true, "HOUR": true, "MINUTE": true, "SECOND": true,
+	"MICROSECOND": true, "EPOCH": true,
+}
+
+// evalExtract returns a field of a date or time as an INT: WEEK is the
+// ISO week, DOW the day of the week (0 is Sunday), DOY the day of the year
+// and EPOCH the number of seconds since 1970-01-01 (since midnight for a
+// TIME).
+func evalExtract(e *ExtractExpr, sc *scope) (db.Value, error) {
+	v, err := evalValue(e.Expr, sc)
+	if err != nil || v.IsNull() {
+		return db.Null(), err
+	}
+	call := &FuncCall{Name: "EXTRACT", Pos: e.Pos}
+	if v, err = anyTemporalArg(call, v); err != nil {
+		return db.Value{}, err
+	}
+
+	t := v.Time()
+	clockOnly := v.Kind() == db.KindTime
+	switch e.Field {
+	case "HOUR":
+		return db.Int(int64(t.Hour())), nil
+	case "MINUTE":
+		return db.Int(int64(t.Minute())), nil
+	case "SECOND":
+		return db.Int(int64(t.Second())), nil
+	case "MICROSECOND":
+		return db.Int(int64(t.Nanosecond() / 1000)), nil
+	case "EPOCH":
+		if clockOnly {
+			return db.Int(int64(v.Clock() / time.Second)), nil
+		}
+		return db.Int(t.Unix()), nil
+	}
+	if clockOnly {
+		return db.Value{}, fmt.Errorf("%s: cannot extract %s from a TIME", e.Pos, e.Field)
+	}
+
+	switch e.Field {
+	case "YEAR":
+		return db.Int(int64(t.Year())), nil
+	case "QUARTER":
+		return db.Int(int64(t.Month()+2) / 3), nil
+	case "MONTH":
+		return db.Int(int64(t.Month())), nil
+	case "WEEK":
+		_, week := t.ISOWeek()
+		return db.Int(int64(week)), nil
+	case "DAY":
+		return db.Int(int64(t.Day())), nil
+	case "DOW":
+		return db.Int(int64(t.Weekday())), nil
+	case "DOY":
+		return db.Int(int64(t.YearDay())), nil
+	}
+	return db.Value{}, fmt.Errorf("%s: unknown field %s", e.Pos, e.Field)
+}
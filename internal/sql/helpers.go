@@ -2,53 +2,14 @@ package sql
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
-)
-
-type Condition struct {
-	Column   string
-	Operator string // "=" or "LIKE"
-	Value    string
-}
-
-type WhereClause struct {
-	Conditions []Condition
-	Operator   string // "AND" or "OR"
-}
-
-func (w *WhereClause) Evaluate(row map[string]string) bool {
-	if len(w.Conditions) == 0 {
-		return true
-	}
-
-	if w.Operator == "AND" {
-		for _, cond := range w.Conditions {
-			if !evaluateCondition(row[cond.Column], cond.Operator, cond.Value) {
-				return false
-			}
-		}
-		return true
-	}
 
-	// OR operator
-	for _, cond := range w.Conditions {
-		if evaluateCondition(row[cond.Column], cond.Operator, cond.Value) {
-			return true
-		}
-	}
-	return false
-}
-
-func evaluateCondition(rowValue, operator, condValue string) bool {
-	switch operator {
-	case "=":
-		return rowValue == condValue
-	case "LIKE":
-		return matchPattern(rowValue, condValue)
-	default:
-		return false
-	}
-}
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+	"github.com/abmcmanu/go-mini-sqlite/internal/util"
+)
 
 func matchPattern(value, pattern string) bool {
 	// Convert SQL LIKE pattern to regex-like matching
@@ -88,48 +49,118 @@ func matchPattern(value, pattern string) bool {
 	return j == patternLen
 }
 
-func splitAndTrim(s string) []string {
-	parts := strings.Split(s, ",")
-	for i := range parts {
-		parts[i] = strings.TrimSpace(parts[i])
+// sortByKeys sorts items by their keys, keys[i] being those of items[i]:
+// the first keys are compared, then the second ones when equal, and so
+// on, in the order orders[k] gives the k-th keys. Items with equal keys
+// keep their order.
+func sortByKeys[T any](items []T, keys [][]db.Value, orders []OrderBy) {
+	type keyed struct {
+		item T
+		keys []db.Value
+	}
+	sorted := make([]keyed, len(items))
+	for i, item := range items {
+		sorted[i] = keyed{item, keys[i]}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareKeys(sorted[i].keys, sorted[j].keys, orders) < 0
+	})
+	for i, k := range sorted {
+		items[i] = k.item
+		keys[i] = k.keys
 	}
-	return parts
 }
 
-// sortRows sorts rows by column in ASC or DESC direction
-func sortRows(rows []map[string]string, column, direction string) {
-	less := func(i, j int) bool {
-		valI := rows[i][column]
-		valJ := rows[j][column]
-
-		numI, errI := parseNumber(valI)
-		numJ, errJ := parseNumber(valJ)
+// page returns the items LIMIT and OFFSET keep: at most limit items, or
+// all of them when limit is negative, after the first offset ones.
+func page[T any](items []T, limit, offset int) []T {
+	items = items[min(offset, len(items)):]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
 
-		if errI == nil && errJ == nil {
-			if direction == "DESC" {
-				return numI > numJ
+// compareKeys compares two lists of keys as sortByKeys orders them.
+func compareKeys(a, b []db.Value, orders []OrderBy) int {
+	for k := range a {
+		// compareForSort puts NULLs first
+		cmp := compareForSort(a[k], b[k])
+		if a[k].IsNull() || b[k].IsNull() {
+			if orders[k].nullsLast() {
+				cmp = -cmp
 			}
-			return numI < numJ
+		} else if orders[k].Desc {
+			cmp = -cmp
 		}
-
-		if direction == "DESC" {
-			return valI > valJ
+		if cmp != 0 {
+			return cmp
 		}
-		return valI < valJ
 	}
+	return 0
+}
 
-	// Bubble sort
-	for i := 0; i < len(rows)-1; i++ {
-		for j := i + 1; j < len(rows); j++ {
-			if !less(i, j) {
-				rows[i], rows[j] = rows[j], rows[i]
-			}
-		}
+// nullsLast reports whether NULLs come after the other values.
+func (o OrderBy) nullsLast() bool {
+	if o.Nulls == "" {
+		return o.Desc
 	}
+	return o.Nulls == "LAST"
+}
+
+// compareForSort orders any two values: NULL first, then values of
+// comparable kinds by value, and the others by their text.
+func compareForSort(a, b db.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	if cmp, ok := db.Compare(a, b); ok {
+		return cmp
+	}
+	return strings.Compare(a.String(), b.String())
 }
 
 func parseNumber(s string) (float64, error) {
-	var num float64
-	_, err := fmt.Sscanf(s, "%f", &num)
-	return num, err
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+// ratOf returns the exact value of a number, or of a text holding one.
+func ratOf(v db.Value) (*big.Rat, error) {
+	if v.IsNumber() {
+		return v.Rat(), nil
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(v.String()))
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a number", v)
+	}
+	return r, nil
+}
+
+// printResult prints the rows of a query result with util.PrintRows.
+func printResult(res *result) {
+	cells := make([][]string, len(res.rows))
+	for i, row := range res.rows {
+		cells[i] = make([]string, len(row))
+		for j, v := range row {
+			cells[i][j] = displayValue(v)
+		}
+	}
+	util.PrintRows(res.cols, cells)
+}
+
+// displayValue returns the text of a value in a result table; long blobs
+// are summarised.
+func displayValue(v db.Value) string {
+	switch {
+	case v.IsNull():
+		return "NULL"
+	case v.Kind() == db.KindBlob:
+		return util.FormatBlob(v.Bytes())
+	}
+	return v.String()
 }
@@ -0,0 +1,321 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// parseFrom reads the tables of the FROM clause:
+//
+//	source { "," source | CROSS JOIN source
+//	       | [INNER] JOIN source ON cond | LEFT [OUTER] JOIN source ON cond }
+//
+// where a source is "table [[AS] alias]" or "(SELECT ...) [AS] alias".
+func (p *parser) parseFrom(stmt *SelectStmt) error {
+	from, err := p.source()
+	if err != nil {
+		return err
+	}
+	stmt.From = from
+
+	for {
+		join := Join{Kind: "INNER"}
+		switch {
+		case p.acceptSymbol(","):
+			join.Kind = "CROSS"
+		case p.acceptKeyword("CROSS"):
+			join.Kind = "CROSS"
+			err = p.joinKeyword()
+		case p.acceptKeyword("LEFT"):
+			join.Kind = "LEFT"
+			p.acceptKeyword("OUTER")
+			err = p.joinKeyword()
+		case p.acceptKeyword("INNER"):
+			err = p.joinKeyword()
+		case p.acceptKeyword("JOIN"):
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if join.Source, err = p.source(); err != nil {
+			return err
+		}
+		if join.Kind != "CROSS" {
+			if _, err := p.expectKeyword("ON"); err != nil {
+				return err
+			}
+			if join.On, err = p.parseExpr(); err != nil {
+				return err
+			}
+			if err := noAggregate(join.On, "ON"); err != nil {
+				return err
+			}
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+}
+
+func (p *parser) joinKeyword() error {
+	_, err := p.expectKeyword("JOIN")
+	return err
+}
+
+// source reads "table [[AS] alias]" or "(SELECT ...) [AS] alias".
+func (p *parser) source() (*Source, error) {
+	src := &Source{Pos: p.peek().Pos}
+	var err error
+	if p.isSymbol("(") {
+		if src.Query, err = p.subquery(); err != nil {
+			return nil, err
+		}
+	} else if src.Table, err = p.tableRef(); err != nil {
+		return nil, err
+	} else {
+		src.CTE = p.lookupCTE(src.Table.Name)
+	}
+
+	if p.acceptKeyword("AS") {
+		alias, err := p.ident("an alias")
+		if err != nil {
+			return nil, err
+		}
+		src.Alias = alias.Text
+	} else if next := p.peek(); next.Kind == tokIdent && !reserved[next.keyword()] {
+		src.Alias = p.next().Text
+	} else if src.Query != nil {
+		return nil, p.unexpected("an alias for the subquery")
+	}
+	return src, nil
+}
+
+// text writes the source back as SQL.
+func (s *Source) text() string {
+	text := s.Table.Name
+	if s.Query != nil {
+		text = "(" + s.Query.text() + ")"
+	}
+	if s.Alias != "" {
+		text += " AS " + s.Alias
+	}
+	return text
+}
+
+// source is a table of the FROM clause being read: a table of the
+// database, or the rows of a derived table.
+type source struct {
+	table *db.Table // nil for a derived table
+	rows  []db.Row
+}
+
+// scan returns every row of the source.
+func (src *source) scan(tx *db.Tx) []db.Row {
+	if src.table == nil {
+		return src.rows
+	}
+	return tx.Rows(src.table)
+}
+
+// openSources opens the tables of the FROM clause, adding them to scope
+// sc, and runs the subqueries of derived tables.
+func (s *SelectStmt) openSources(sc *scope) ([]*source, error) {
+	sources := []*Source{s.From}
+	for _, j := range s.Joins {
+		sources = append(sources, j.Source)
+	}
+
+	opened := make([]*source, len(sources))
+	for i, src := range sources {
+		for _, ts := range sc.tables {
+			if ts.name == src.Name() {
+				return nil, fmt.Errorf("%s: table name '%s' is used twice — give one an alias", src.Pos, src.Name())
+			}
+		}
+
+		if src.Query == nil && src.CTE == nil {
+			t, err := sc.q.d.GetTable(src.Table.Name)
+			if err != nil {
+				return nil, err
+			}
+			opened[i] = &source{table: t}
+			sc.tables = append(sc.tables, newTableScope(src.Name(), t.Schema))
+			continue
+		}
+
+		var schema db.Schema
+		var rows []db.Row
+		var err error
+		if src.CTE != nil {
+			schema, rows, err = cteTable(src, sc)
+		} else {
+			schema, rows, err = sc.derivedTable(src)
+		}
+		if err != nil {
+			return nil, err
+		}
+		opened[i] = &source{rows: rows}
+		sc.tables = append(sc.tables, newTableScope(src.Name(), schema))
+	}
+
+	// An ON condition may only use the tables joined so far
+	for i, j := range s.Joins {
+		if j.On != nil {
+			if err := checkColumns(j.On, sc.prefix(i+2)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return opened, nil
+}
+
+// derivedTable returns the columns and rows of a derived table, running
+// its subquery. It cannot see the tables next to it in the FROM clause of
+// sc, only those of the enclosing query.
+func (sc *scope) derivedTable(src *Source) (db.Schema, []db.Row, error) {
+	res, correlated, err := sc.q.subquery(src.Query, sc.outer)
+	if err != nil {
+		return db.Schema{}, nil, err
+	}
+	if correlated {
+		*sc.correlated = true
+	}
+	return tableOf(src, res)
+}
+
+// tableOf returns the columns and rows of a source holding res.
+func tableOf(src *Source, res *result) (db.Schema, []db.Row, error) {
+	var schema db.Schema
+	for _, name := range res.cols {
+		for _, c := range schema.Columns {
+			if c.Name == name {
+				return db.Schema{}, nil, fmt.Errorf("%s: column '%s' appears twice in '%s' — give one an alias", src.Pos, name, src.Name())
+			}
+		}
+		schema.Columns = append(schema.Columns, db.Column{Name: name})
+	}
+
+	rows := make([]db.Row, len(res.rows))
+	for i, values := range res.rows {
+		rows[i] = make(db.Row, len(values))
+		for j, v := range values {
+			rows[i][res.cols[j]] = v
+		}
+	}
+	return schema, rows, nil
+}
+
+// joinRows returns the rows of the FROM clause: each holds a row of every
+// table, or nil for a table of a LEFT JOIN that no row matched. A table
+// joined on "its primary key = value" is read by key rather than scanned.
+func (s *SelectStmt) joinRows(sources []*source, sc *scope) ([][]db.Row, error) {
+	tx := sc.q.tx
+	var joined [][]db.Row
+	for _, row := range sources[0].scan(tx) {
+		joined = append(joined, []db.Row{row})
+	}
+
+	for i, j := range s.Joins {
+		src := sources[i+1]
+		left := sc.prefix(i + 1)
+		on := sc.prefix(i + 2)
+		var key Expr
+		if src.table != nil {
+			key = pkLookup(j.On, left, on)
+		}
+
+		var scanned []db.Row
+		if key == nil {
+			scanned = src.scan(tx)
+		}
+
+		var next [][]db.Row
+		for _, rows := range joined {
+			candidates := scanned
+			if key != nil {
+				left.bind(rows...)
+				row, found, err := getByKey(tx, src.table, key, left)
+				if err != nil {
+					return nil, err
+				}
+				candidates = nil
+				if found {
+					candidates = []db.Row{row}
+				}
+			}
+
+			matched := false
+			for _, row := range candidates {
+				combined := append(rows[:len(rows):len(rows)], row)
+				on.bind(combined...)
+				ok, err := matches(j.On, on)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					next = append(next, combined)
+					matched = true
+				}
+			}
+			if !matched && j.Kind == "LEFT" {
+				next = append(next, append(rows[:len(rows):len(rows)], nil))
+			}
+		}
+		joined = next
+	}
+	return joined, nil
+}
+
+// pkLookup returns the value the joined table of scope on is looked up by
+// when cond is, or starts with, "primary key = value": value only uses the
+// tables of scope left. It returns nil when the table has to be scanned.
+func pkLookup(cond Expr, left, on *scope) Expr {
+	for {
+		and, ok := cond.(*BinaryExpr)
+		if !ok || and.Op != "AND" {
+			break
+		}
+		if key := pkLookup(and.Left, left, on); key != nil {
+			return key
+		}
+		cond = and.Right
+	}
+
+	eq, ok := cond.(*BinaryExpr)
+	if !ok || eq.Op != "=" {
+		return nil
+	}
+	joined := on.tables[len(on.tables)-1]
+	isKey := func(e Expr) bool {
+		ref, ok := e.(*ColumnRef)
+		if !ok {
+			return false
+		}
+		ts, col, err := on.column(ref)
+		return err == nil && ts == joined && col.PrimaryKey
+	}
+	switch {
+	case isKey(eq.Left) && checkColumns(eq.Right, left) == nil:
+		return eq.Right
+	case isKey(eq.Right) && checkColumns(eq.Left, left) == nil:
+		return eq.Left
+	}
+	return nil
+}
+
+// getByKey returns the row of t whose primary key is the value of key.
+func getByKey(tx *db.Tx, t *db.Table, key Expr, sc *scope) (db.Row, bool, error) {
+	v, err := evalValue(key, sc)
+	if err != nil || v.IsNull() {
+		return nil, false, err
+	}
+	pk := t.Schema.ColumnsMap()[t.PrimaryKey()]
+	if v, err = pk.Coerce(v); err != nil {
+		// The key cannot hold the value, so no row has it
+		return nil, false, nil
+	}
+	row, found := tx.Get(t, v.Key())
+	return row, found, nil
+}
@@ -0,0 +1,63 @@
+package sql
+
+import "testing"
+
+// ordersSchema adds the orders of the users of usersSchema, and one
+// order of a user who does not exist.
+var ordersSchema = []string{
+	"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+	"INSERT INTO orders (id, user_id, amount) VALUES (10, 1, 5)",
+	"INSERT INTO orders (id, user_id, amount) VALUES (11, 1, 7)",
+	"INSERT INTO orders (id, user_id, amount) VALUES (12, 2, 3)",
+	"INSERT INTO orders (id, user_id, amount) VALUES (13, 9, 1)",
+}
+
+func TestJoins(t *testing.T) {
+	d := openTestDB(t, append(usersSchema, ordersSchema...)...)
+	checkQueries(t, d, []queryTest{
+		{
+			query: "SELECT u.name, o.amount FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.id",
+			want:  []string{"ann|5", "ann|7", "bob|3"},
+		},
+		{
+			query: "SELECT users.name, orders.id FROM users INNER JOIN orders ON orders.user_id = users.id AND orders.amount > 4",
+			want:  []string{"ann|10", "ann|11"},
+		},
+		{
+			query: "SELECT u.name, o.id FROM users AS u LEFT JOIN orders AS o ON o.user_id = u.id ORDER BY u.id, o.id",
+			want:  []string{"ann|10", "ann|11", "bob|12", "cat|NULL", "dan|NULL"},
+		},
+		{
+			query: "SELECT u.name FROM users u LEFT OUTER JOIN orders o ON o.user_id = u.id WHERE o.id IS NULL",
+			want:  []string{"cat", "dan"},
+		},
+		{
+			query: "SELECT COUNT(*) FROM users CROSS JOIN orders",
+			want:  []string{"16"},
+		},
+		{
+			query: "SELECT u.name, o.amount FROM users u, orders o WHERE u.id = o.user_id AND o.amount < 5",
+			want:  []string{"bob|3"},
+		},
+		{
+			query: "SELECT u.name, SUM(o.amount) FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.name ORDER BY u.name",
+			want:  []string{"ann|12", "bob|3"},
+		},
+		{
+			query: "SELECT o.* FROM orders o JOIN users u ON u.id = o.user_id WHERE u.name = 'bob'",
+			want:  []string{"12|2|3"},
+		},
+		{
+			query: "SELECT id FROM users JOIN orders ON orders.user_id = users.id",
+			err:   "ambiguous",
+		},
+		{
+			query: "SELECT x.name FROM users u",
+			err:   "x",
+		},
+		{
+			query: "SELECT * FROM users JOIN missing ON missing.id = users.id",
+			err:   "table 'missing' not found",
+		},
+	})
+}
@@ -0,0 +1,236 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // identifier or keyword, possibly `quoted`
+	tokString           // 'text' or "text", Text holds the unquoted value
+	tokNumber           // 42, 3.14
+	tokBlob             // X'CAFE', Text holds the hex digits
+	tokSymbol           // operator or punctuation
+)
+
+type token struct {
+	Kind   tokenKind
+	Text   string
+	Quoted bool // identifier written between backquotes
+	Pos    Pos
+}
+
+// keyword returns the upper-cased text of an unquoted identifier, or "".
+func (t token) keyword() string {
+	if t.Kind != tokIdent || t.Quoted {
+		return ""
+	}
+	return strings.ToUpper(t.Text)
+}
+
+func (t token) String() string {
+	switch t.Kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return fmt.Sprintf("string %q", t.Text)
+	case tokNumber:
+		return "number " + t.Text
+	case tokBlob:
+		return "blob X'" + t.Text + "'"
+	case tokIdent:
+		if t.Quoted {
+			return "`" + t.Text + "`"
+		}
+	}
+	return fmt.Sprintf("%q", t.Text)
+}
+
+// symbols lists the operators and punctuation, longest first.
+var symbols = []string{
+	"<=", ">=", "<>", "!=", "||",
+	"(", ")", ",", ";", ".", "*", "=", "<", ">", "+", "-", "/", "%",
+}
+
+// lexer splits a query into tokens. Whitespace and comments (-- to the
+// end of the line, /* ... */) are skipped.
+type lexer struct {
+	src  []rune
+	off  int
+	line int
+	col  int
+}
+
+func tokenize(query string) ([]token, error) {
+	l := &lexer{src: []rune(query), line: 1, col: 1}
+	var toks []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+		if tok.Kind == tokEOF {
+			return toks, nil
+		}
+	}
+}
+
+func (l *lexer) peek(n int) rune {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() rune {
+	r := l.src[l.off]
+	l.off++
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{Line: l.line, Col: l.col}
+}
+
+func (l *lexer) skipSpace() error {
+	for l.off < len(l.src) {
+		switch r := l.peek(0); {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '-' && l.peek(1) == '-':
+			for l.off < len(l.src) && l.peek(0) != '\n' {
+				l.advance()
+			}
+		case r == '/' && l.peek(1) == '*':
+			start := l.pos()
+			l.advance()
+			l.advance()
+			for !(l.peek(0) == '*' && l.peek(1) == '/') {
+				if l.off >= len(l.src) {
+					return incompleteError(start, "unterminated comment")
+				}
+				l.advance()
+			}
+			l.advance()
+			l.advance()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	start := l.pos()
+	if l.off >= len(l.src) {
+		return token{Kind: tokEOF, Pos: start}, nil
+	}
+
+	r := l.peek(0)
+	switch {
+	case (r == 'x' || r == 'X') && l.peek(1) == '\'':
+		l.advance()
+		text, err := l.quoted('\'')
+		if err != nil {
+			return token{}, err
+		}
+		if len(text)%2 != 0 {
+			return token{}, syntaxError(start, "blob literal needs an even number of hex digits")
+		}
+		for _, c := range text {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return token{}, syntaxError(start, fmt.Sprintf("unexpected %q in blob literal", c))
+			}
+		}
+		return token{Kind: tokBlob, Text: strings.ToUpper(text), Pos: start}, nil
+
+	case r == '_' || unicode.IsLetter(r):
+		begin := l.off
+		for r := l.peek(0); r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r); r = l.peek(0) {
+			l.advance()
+		}
+		return token{Kind: tokIdent, Text: string(l.src[begin:l.off]), Pos: start}, nil
+
+	case unicode.IsDigit(r) || r == '.' && unicode.IsDigit(l.peek(1)):
+		begin := l.off
+		for unicode.IsDigit(l.peek(0)) {
+			l.advance()
+		}
+		if l.peek(0) == '.' && unicode.IsDigit(l.peek(1)) {
+			l.advance()
+			for unicode.IsDigit(l.peek(0)) {
+				l.advance()
+			}
+		}
+		if r := l.peek(0); r == '_' || unicode.IsLetter(r) {
+			return token{}, syntaxError(l.pos(), fmt.Sprintf("unexpected %q in number", r))
+		}
+		return token{Kind: tokNumber, Text: string(l.src[begin:l.off]), Pos: start}, nil
+
+	case r == '\'' || r == '"' || r == '`':
+		text, err := l.quoted(r)
+		if err != nil {
+			return token{}, err
+		}
+		if r == '`' {
+			if text == "" {
+				return token{}, syntaxError(start, "empty quoted identifier")
+			}
+			return token{Kind: tokIdent, Text: text, Quoted: true, Pos: start}, nil
+		}
+		return token{Kind: tokString, Text: text, Pos: start}, nil
+	}
+
+	for _, sym := range symbols {
+		if l.hasPrefix(sym) {
+			for range sym {
+				l.advance()
+			}
+			return token{Kind: tokSymbol, Text: sym, Pos: start}, nil
+		}
+	}
+	return token{}, syntaxError(start, fmt.Sprintf("unexpected character %q", r))
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	for i, r := range []rune(s) {
+		if l.peek(i) != r {
+			return false
+		}
+	}
+	return true
+}
+
+// quoted reads text between quotes; a doubled quote stands for itself.
+func (l *lexer) quoted(quote rune) (string, error) {
+	start := l.pos()
+	l.advance()
+	var sb strings.Builder
+	for {
+		if l.off >= len(l.src) {
+			return "", incompleteError(start, "unterminated quoted text")
+		}
+		r := l.advance()
+		if r == quote {
+			if l.peek(0) != quote {
+				return sb.String(), nil
+			}
+			l.advance()
+		}
+		sb.WriteRune(r)
+	}
+}
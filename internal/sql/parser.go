@@ -1,7 +1,9 @@
 package sql
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/abmcmanu/go-mini-sqlite/internal/db"
@@ -11,36 +13,640 @@ type Statement interface {
 	Exec(database *db.Database) error
 }
 
+// ErrIncomplete is wrapped by syntax errors caused by the query ending
+// too early, so that a shell can read more input before giving up.
+var ErrIncomplete = errors.New("incomplete statement")
+
+// SyntaxError reports an invalid query and where the problem was found.
+type SyntaxError struct {
+	Pos        Pos
+	Msg        string
+	incomplete bool
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	if e.incomplete {
+		return ErrIncomplete
+	}
+	return nil
+}
+
+func syntaxError(pos Pos, msg string) error {
+	return &SyntaxError{Pos: pos, Msg: msg}
+}
+
+func incompleteError(pos Pos, msg string) error {
+	return &SyntaxError{Pos: pos, Msg: msg, incomplete: true}
+}
+
+// Parse parses a single statement, optionally ended by a semicolon.
 func Parse(query string) (Statement, error) {
-	query = strings.TrimSpace(query)
-	queryUpper := strings.ToUpper(query)
+	toks, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if tok := p.peek(); tok.Kind != tokEOF {
+		return nil, syntaxError(tok.Pos, fmt.Sprintf("unexpected %s after the end of the statement", tok))
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	tok := p.peek()
+	switch tok.keyword() {
+	case "CREATE":
+		p.next()
+		switch {
+		case p.acceptKeyword("DATABASE"):
+			return p.parseCreateDatabase()
+		case p.acceptKeyword("TABLE"):
+			return p.parseCreateTable()
+		}
+		return nil, p.unexpected("DATABASE or TABLE")
+	case "DROP":
+		p.next()
+		switch {
+		case p.acceptKeyword("DATABASE"):
+			return p.parseDropDatabase()
+		case p.acceptKeyword("TABLE"):
+			return p.parseDropTable()
+		}
+		return nil, p.unexpected("DATABASE or TABLE")
+	case "SHOW":
+		p.next()
+		switch {
+		case p.acceptKeyword("DATABASES"):
+			return &ShowDatabasesStmt{}, nil
+		case p.acceptKeyword("TABLES"):
+			return &ShowTablesStmt{}, nil
+		}
+		return nil, p.unexpected("DATABASES or TABLES")
+	case "DESCRIBE", "DESC":
+		p.next()
+		return p.parseDescribe()
+	case "USE":
+		p.next()
+		return p.parseUseDatabase()
+	case "INSERT":
+		p.next()
+		return p.parseInsert()
+	case "SELECT":
+		p.next()
+		return p.parseSelect()
+	case "WITH":
+		p.next()
+		return p.parseWith()
+	case "UPDATE":
+		p.next()
+		return p.parseUpdate()
+	case "DELETE":
+		p.next()
+		return p.parseDelete()
+	case "BEGIN", "START":
+		p.next()
+		return p.parseBegin()
+	case "COMMIT", "END":
+		p.next()
+		return p.parseCommit()
+	case "ROLLBACK":
+		p.next()
+		return p.parseRollback()
+	case "SAVEPOINT":
+		p.next()
+		return p.parseSavepoint()
+	case "RELEASE":
+		p.next()
+		return p.parseRelease()
+	}
+
+	if tok.Kind == tokEOF || tok.Kind == tokSymbol {
+		return nil, p.unexpected("a statement")
+	}
+	return nil, syntaxError(tok.Pos, fmt.Sprintf("unknown SQL command %s", tok))
+}
+
+// reserved lists the keywords that cannot be used as unquoted names.
+var reserved = map[string]bool{
+	"AND": true, "AS": true, "BETWEEN": true, "BY": true, "CREATE": true, "CROSS": true,
+	"DELETE": true, "DISTINCT": true, "DROP": true, "EXCEPT": true, "EXISTS": true,
+	"FROM": true, "GROUP": true, "HAVING": true, "IN": true, "INNER": true, "INSERT": true, "INTERSECT": true, "INTO": true, "IS": true,
+	"JOIN": true, "LEFT": true, "LIKE": true, "LIMIT": true,
+	"NOT": true, "NULL": true, "OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true, "OVER": true, "PRIMARY": true,
+	"SELECT": true, "SET": true, "TABLE": true, "UNION": true, "UNIQUE": true,
+	"UPDATE": true, "VALUES": true, "WHERE": true, "WITH": true,
+}
+
+// parser is a recursive-descent parser over the tokens of one query.
+type parser struct {
+	toks []token
+	i    int
+	ctes []*CTE // the CTEs visible to the tables of FROM clauses
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+// peekAt returns the token n places after the current one, or the final
+// EOF token past the end.
+func (p *parser) peekAt(n int) token {
+	if p.i+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.i+n]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.Kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// isKeyword reports whether the current token is one of the keywords.
+func (p *parser) isKeyword(keywords ...string) bool {
+	kw := p.peek().keyword()
+	for _, k := range keywords {
+		if kw == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) (token, error) {
+	if !p.isKeyword(kw) {
+		return token{}, p.unexpected(kw)
+	}
+	return p.next(), nil
+}
+
+func (p *parser) isSymbol(sym string) bool {
+	tok := p.peek()
+	return tok.Kind == tokSymbol && tok.Text == sym
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	if p.isSymbol(sym) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(sym string) (token, error) {
+	if !p.isSymbol(sym) {
+		return token{}, p.unexpected(fmt.Sprintf("%q", sym))
+	}
+	return p.next(), nil
+}
+
+// unexpected reports the current token as not matching what was expected.
+func (p *parser) unexpected(expected string) error {
+	tok := p.peek()
+	msg := fmt.Sprintf("expected %s, found %s", expected, tok)
+	if tok.Kind == tokEOF {
+		return incompleteError(tok.Pos, msg)
+	}
+	return syntaxError(tok.Pos, msg)
+}
+
+// ident reads the name of a database, table, column or savepoint.
+func (p *parser) ident(what string) (token, error) {
+	tok := p.peek()
+	if tok.Kind != tokIdent || reserved[tok.keyword()] {
+		return token{}, p.unexpected(what)
+	}
+	return p.next(), nil
+}
+
+func (p *parser) tableRef() (TableRef, error) {
+	tok, err := p.ident("a table name")
+	if err != nil {
+		return TableRef{}, err
+	}
+	return TableRef{Name: tok.Text, Pos: tok.Pos}, nil
+}
+
+func (p *parser) columnRef() (*ColumnRef, error) {
+	tok, err := p.ident("a column name")
+	if err != nil {
+		return nil, err
+	}
+	return &ColumnRef{Name: tok.Text, Pos: tok.Pos}, nil
+}
+
+// qualifiedColumnRef reads "column" or "table.column".
+func (p *parser) qualifiedColumnRef() (*ColumnRef, error) {
+	ref, err := p.columnRef()
+	if err != nil || !p.acceptSymbol(".") {
+		return ref, err
+	}
+	col, err := p.columnRef()
+	if err != nil {
+		return nil, err
+	}
+	col.Table, col.Pos = ref.Name, ref.Pos
+	return col, nil
+}
+
+// columnList reads "(name, ...)".
+func (p *parser) columnList() ([]*ColumnRef, error) {
+	if _, err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var cols []*ColumnRef
+	for {
+		col, err := p.columnRef()
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return cols, nil
+}
+
+// literal reads a string, a number (possibly negative) or NULL.
+func (p *parser) literal() (*Literal, error) {
+	tok := p.peek()
+	switch {
+	case tok.keyword() == "NULL":
+		p.next()
+		return &Literal{Kind: LitNull, Pos: tok.Pos}, nil
+	case tok.keyword() == "TRUE" || tok.keyword() == "FALSE":
+		p.next()
+		return &Literal{Kind: LitBool, Value: tok.keyword(), Pos: tok.Pos}, nil
+	case tok.Kind == tokString:
+		p.next()
+		return &Literal{Kind: LitString, Value: tok.Text, Pos: tok.Pos}, nil
+	case tok.Kind == tokNumber:
+		p.next()
+		return &Literal{Kind: LitNumber, Value: tok.Text, Pos: tok.Pos}, nil
+	case tok.Kind == tokBlob:
+		p.next()
+		return &Literal{Kind: LitBlob, Value: tok.Text, Pos: tok.Pos}, nil
+	case p.isSymbol("-") && p.toks[p.i+1].Kind == tokNumber:
+		p.next()
+		num := p.next()
+		return &Literal{Kind: LitNumber, Value: "-" + num.Text, Pos: tok.Pos}, nil
+	}
+	return nil, p.unexpected("a value")
+}
+
+// operand reads a value: a literal, a function call or a (qualified)
+// column.
+func (p *parser) operand() (Expr, error) {
+	tok := p.peek()
+	switch tok.keyword() {
+	case "NULL", "TRUE", "FALSE":
+		return p.literal()
+	}
+	if tok.Kind != tokIdent {
+		return p.literal()
+	}
+	if next := p.toks[p.i+1]; next.Kind == tokSymbol && next.Text == "(" && !tok.Quoted {
+		if _, ok := aggregates[tok.keyword()]; ok {
+			return p.aggregateCall()
+		}
+		if _, ok := windowFunctions[tok.keyword()]; ok {
+			return p.windowCall()
+		}
+		return p.funcCall()
+	}
+	if niladic[tok.keyword()] {
+		p.next()
+		return &FuncCall{Name: tok.keyword(), Pos: tok.Pos}, nil
+	}
+	return p.qualifiedColumnRef()
+}
+
+// funcCall reads "name(arg, ...)"; EXTRACT reads "EXTRACT(field FROM
+// value)", and arguments of DATE_ADD and DATE_SUB may be intervals.
+func (p *parser) funcCall() (Expr, error) {
+	name := p.next()
+	p.next() // (
+
+	if name.keyword() == "EXTRACT" {
+		field, err := p.ident("a date or time field")
+		if err != nil {
+			return nil, err
+		}
+		if !extractFields[field.keyword()] {
+			return nil, syntaxError(field.Pos, fmt.Sprintf("unknown field %s", field.Text))
+		}
+		if _, err := p.expectKeyword("FROM"); err != nil {
+			return nil, err
+		}
+		e, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &ExtractExpr{Field: field.keyword(), Expr: e, Pos: name.Pos}, nil
+	}
+
+	fn, ok := functions[name.keyword()]
+	if !ok {
+		return nil, syntaxError(name.Pos, fmt.Sprintf("unknown function %s", name.Text))
+	}
+	call := &FuncCall{Name: name.keyword(), Pos: name.Pos}
+	for !p.acceptSymbol(")") {
+		if len(call.Args) > 0 {
+			if _, err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+		var arg Expr
+		var err error
+		if p.isKeyword("INTERVAL") {
+			arg, err = p.interval()
+		} else {
+			arg, err = p.parseExpr()
+		}
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+
+	if n := len(call.Args); n < fn.minArgs || (fn.maxArgs >= 0 && n > fn.maxArgs) {
+		return nil, syntaxError(name.Pos, fmt.Sprintf("%s takes %s", call.Name, fn.arity()))
+	}
+	return call, nil
+}
+
+// interval reads "INTERVAL value unit"; units may be plural (3 DAYS).
+func (p *parser) interval() (Expr, error) {
+	tok := p.next()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	unit, err := p.ident("an interval unit")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(unit.keyword(), "S")
+	if !intervalUnits[name] {
+		return nil, syntaxError(unit.Pos, fmt.Sprintf("unknown interval unit %s", unit.Text))
+	}
+	return &IntervalExpr{Value: value, Unit: name, Pos: tok.Pos}, nil
+}
+
+// parseExpr reads an expression. From the loosest to the tightest
+// binding:
+//
+//	expr      = and { OR and }
+//	and       = not { AND not }
+//	not       = NOT not | predicate
+//	predicate = value [ op value | [NOT] LIKE value | [NOT] IN (value, ...)
+//	            | [NOT] BETWEEN value AND value | IS [NOT] NULL ]
+//	value     = sum { "||" sum }
+//	sum       = term { ("+" | "-") term }
+//	term      = unary { ("*" | "/" | "%") unary }
+//	unary     = "-" unary | primary
+//	primary   = "(" expr ")" | operand
+//
+// where op is a comparison operator.
+func (p *parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right, Pos: tok.Pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		tok := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right, Pos: tok.Pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("NOT") {
+		tok := p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Operand: operand, Pos: tok.Pos}, nil
+	}
+	return p.parsePredicate()
+}
+
+// comparisonOps maps the comparison operators to their AST form.
+var comparisonOps = map[string]string{
+	"=": "=", "<>": "<>", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+// parsePredicate reads a value, possibly compared or tested.
+func (p *parser) parsePredicate() (Expr, error) {
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Kind == tokSymbol && comparisonOps[tok.Text] != "" {
+		p.next()
+		right, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: comparisonOps[tok.Text], Left: left, Right: right, Pos: tok.Pos}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if _, err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: not, Pos: tok.Pos}, nil
+	}
 
+	if !p.isKeyword("NOT", "LIKE", "IN", "BETWEEN") {
+		return left, nil
+	}
+	not := p.acceptKeyword("NOT")
 	switch {
-	case strings.HasPrefix(queryUpper, "CREATE DATABASE"):
-		return parseCreateDatabase(query)
-	case strings.HasPrefix(queryUpper, "DROP DATABASE"):
-		return parseDropDatabase(query)
-	case strings.HasPrefix(queryUpper, "SHOW DATABASES"):
-		return parseShowDatabases(query)
-	case strings.HasPrefix(queryUpper, "SHOW TABLES"):
-		return parseShowTables(query)
-	case strings.HasPrefix(queryUpper, "DESCRIBE "), strings.HasPrefix(queryUpper, "DESC "):
-		return parseDescribe(query)
-	case strings.HasPrefix(queryUpper, "USE "):
-		return parseUseDatabase(query)
-	case strings.HasPrefix(queryUpper, "CREATE TABLE"):
-		return parseCreateTable(query)
-	case strings.HasPrefix(queryUpper, "DROP TABLE"):
-		return parseDropTable(query)
-	case strings.HasPrefix(queryUpper, "INSERT INTO"):
-		return parseInsert(query)
-	case strings.HasPrefix(queryUpper, "SELECT"):
-		return parseSelect(query)
-	case strings.HasPrefix(queryUpper, "UPDATE"):
-		return parseUpdate(query)
-	case strings.HasPrefix(queryUpper, "DELETE FROM"):
-		return parseDelete(query)
-	default:
-		return nil, fmt.Errorf("unknown SQL command: %s", query)
-	}
-}
\ No newline at end of file
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		var e Expr = &BinaryExpr{Op: "LIKE", Left: left, Right: pattern, Pos: tok.Pos}
+		if not {
+			e = &UnaryExpr{Op: "NOT", Operand: e, Pos: tok.Pos}
+		}
+		return e, nil
+
+	case p.acceptKeyword("IN"):
+		in := &InExpr{Expr: left, Not: not, Pos: tok.Pos}
+		if p.atSubquery() {
+			pos := p.peek().Pos
+			query, err := p.subquery()
+			if err != nil {
+				return nil, err
+			}
+			in.Query = &SubqueryExpr{Query: query, Pos: pos}
+			return in, nil
+		}
+		if _, err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if _, err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Low: low, High: high, Not: not, Pos: tok.Pos}, nil
+	}
+	return nil, p.unexpected("LIKE, IN or BETWEEN")
+}
+
+// parseValue reads a value: a concatenation of arithmetic expressions.
+func (p *parser) parseValue() (Expr, error) {
+	return p.parseBinary([]string{"||"}, p.parseSum)
+}
+
+func (p *parser) parseSum() (Expr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseTerm)
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	return p.parseBinary([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+// parseBinary reads operands joined by left-associative operators.
+func (p *parser) parseBinary(ops []string, operand func() (Expr, error)) (Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.Kind != tokSymbol || !slices.Contains(ops, tok.Text) {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.Text, Left: left, Right: right, Pos: tok.Pos}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if !p.isSymbol("-") {
+		return p.parsePrimary()
+	}
+	if p.toks[p.i+1].Kind == tokNumber {
+		return p.literal()
+	}
+	tok := p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: "-", Operand: operand, Pos: tok.Pos}, nil
+}
+
+// parsePrimary reads "(expr)", "(SELECT ...)", "EXISTS (SELECT ...)" or
+// an operand.
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+	if p.atSubquery() {
+		query, err := p.subquery()
+		if err != nil {
+			return nil, err
+		}
+		return &SubqueryExpr{Query: query, Pos: tok.Pos}, nil
+	}
+	if p.acceptKeyword("EXISTS") {
+		query, err := p.subquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{Query: query, Pos: tok.Pos}, nil
+	}
+	if p.acceptSymbol("(") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return p.operand()
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Statement
+	}{
+		{"BEGIN", &BeginStmt{}},
+		{"BEGIN TRANSACTION;", &BeginStmt{}},
+		{"START TRANSACTION", &BeginStmt{}},
+		{"commit", &CommitStmt{}},
+		{"END", &CommitStmt{}},
+		{"ROLLBACK", &RollbackStmt{}},
+		{"ROLLBACK TRANSACTION", &RollbackStmt{}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestParseErrors checks that invalid statements are rejected with a
+// syntax error, and never make the parser panic.
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"BEGIN BEGIN", `unexpected "BEGIN" after the end of the statement`},
+		{"COMMIT 5", `unexpected number 5 after the end of the statement`},
+		{"BEGIN; COMMIT", `unexpected "COMMIT" after the end of the statement`},
+		{"SELECT id FROM users WHERE id IN ()", `expected a value, found ")"`},
+		{"SELECT id FROM users WHERE id BETWEEN 1", "expected AND, found end of input"},
+		{"SELECT id FROM users WHERE id IS 5", "expected NULL, found number 5"},
+		{"SELECT id FROM users WHERE id NOT 5", "expected LIKE, IN or BETWEEN"},
+		{"CREATE TABLE t (id INT PRIMARY KEY, n NUMBERS)", "unknown column type 'NUMBERS'"},
+		{"SELECT 1 + FROM users", `column 12: expected a column name, found "FROM"`},
+		{"SELECT (1 + 2 FROM users", `column 15: expected ")", found "FROM"`},
+		{"UPDATE users SET age = WHERE id = 1", `column 24: expected a column name, found "WHERE"`},
+		{"SELECT", "column 7: expected a value, found end of input"},
+		{"SELECT;", `column 7: expected a value, found ";"`},
+		{"SELECT x", "column 9: expected FROM, found end of input"},
+		{"SELECT u.", "column 10: expected a column name, found end of input"},
+		{"SELECT u.*", "column 11: expected FROM, found end of input"},
+		{"SELECT * FROM a JOIN b", "expected ON, found end of input"},
+		{"SELECT * FROM a LEFT b ON a.id = b.id", `expected JOIN, found "b"`},
+		{"SELECT * FROM a CROSS JOIN b ON a.id = b.id", `unexpected "ON" after the end of the statement`},
+		{"SELECT * FROM a AS", "expected an alias, found end of input"},
+		{"SELECT * FROM (SELECT id FROM users)", "expected an alias for the subquery, found end of input"},
+		{"SELECT id FROM users WHERE EXISTS SELECT id FROM users", `expected "(", found "SELECT"`},
+		{"SELECT id FROM users WHERE id IN (SELECT id FROM users", `expected ")", found end of input`},
+		{"SELECT (SELECT) FROM users", `expected a value, found ")"`},
+		{"SELECT id FROM users UNION", "expected SELECT, found end of input"},
+		{"SELECT id FROM users ORDER BY id UNION SELECT id FROM users", `unexpected "UNION" after the end of the statement`},
+		{"SELECT id FROM users INTERSECT ALL SELECT id FROM users", `expected SELECT, found "ALL"`},
+		{"WITH a AS (SELECT id FROM users), a AS (SELECT id FROM users) SELECT id FROM a", "CTE 'a' is defined twice"},
+		{"WITH a AS (SELECT id FROM users)", "expected SELECT, INSERT, UPDATE or DELETE, found end of input"},
+		{"WITH a AS (SELECT id FROM users) SHOW TABLES", `expected SELECT, INSERT, UPDATE or DELETE, found "SHOW"`},
+		{"WITH RECURSIVE n(x) AS (SELECT x FROM n) SELECT x FROM n", "the first SELECT of recursive CTE 'n' cannot read it"},
+		{"SELECT SUM(age) OVER (ORDER BY id ROWS 2 FOLLOWING) FROM users", "a frame cannot start at 2 FOLLOWING, after its end at CURRENT ROW"},
+		{"SELECT SUM(age) OVER (ORDER BY id ROWS UNBOUNDED FOLLOWING) FROM users", "a frame cannot start at UNBOUNDED FOLLOWING"},
+		{"SELECT SUM(age) OVER (ORDER BY id ROWS BETWEEN 1 FOLLOWING AND 1 PRECEDING) FROM users", "a frame cannot start at 1 FOLLOWING, after its end at 1 PRECEDING"},
+		{"SELECT SUM(age) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM users", "a frame cannot start at CURRENT ROW, after its end at 1 PRECEDING"},
+		{"SELECT ROW_NUMBER() FROM users", `expected OVER after ROW_NUMBER(), found "FROM"`},
+		{"SELECT id FROM users WHERE ROW_NUMBER() OVER () > 1", "window function ROW_NUMBER is not allowed in WHERE"},
+		{"SELECT id FROM users LIMIT -1", `expected a row count, found "-"`},
+		{"SELECT id FROM users LIMIT 2 OFFSET", "expected a row count, found end of input"},
+		{"SELECT id FROM users LIMIT 'a'", `expected a row count, found string "a"`},
+		{"SELECT id FROM users ORDER BY id NULLS MIDDLE", `expected FIRST or LAST, found "MIDDLE"`},
+		{"SELECT DISTINCT FROM users", `expected a column name, found "FROM"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.query, err, tt.err)
+		}
+	}
+}
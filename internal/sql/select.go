@@ -0,0 +1,673 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+type SelectStmt struct {
+	Distinct bool
+	Items    []SelectItem
+	From     *Source
+	Joins    []Join
+	Where    Expr // nil when there is no WHERE clause
+	GroupBy  []Expr
+	Having   Expr // nil when there is no HAVING clause
+	// Compound holds the SELECTs combined with this one by UNION and the
+	// like; ORDER BY, LIMIT and OFFSET then apply to the combined result.
+	Compound []Compound
+	OrderBy  []OrderBy
+	Limit    int // -1 when there is no LIMIT clause
+	Offset   int
+}
+
+// parseSelect reads:
+//
+//	SELECT [DISTINCT] item, ... FROM sources [WHERE cond]
+//	  [GROUP BY expr, ... [HAVING cond]]
+//	  { (UNION [ALL] | INTERSECT | EXCEPT) SELECT ... }
+//	  [ORDER BY key, ...] [LIMIT n] [OFFSET m]
+//
+// where an item is "*", "table.*" or "expr [[AS] alias]", sources are the
+// tables read by parseFrom and keys are read by orderByList.
+func (p *parser) parseSelect() (Statement, error) {
+	stmt, err := p.selectStmt()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// selectStmt reads a SELECT statement after its SELECT keyword.
+func (p *parser) selectStmt() (*SelectStmt, error) {
+	stmt, err := p.selectCore()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseCompound(stmt); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.OrderBy, err = p.orderByList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.rowCount(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.rowCount(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// orderByList reads the keys of an ORDER BY clause:
+//
+//	expr [ASC|DESC] [NULLS FIRST | NULLS LAST], ...
+//
+// In the ORDER BY of a SELECT, expr may also be an alias of the SELECT
+// list, or the position of one of its columns, from 1.
+func (p *parser) orderByList() ([]OrderBy, error) {
+	var orders []OrderBy
+	for {
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		order := OrderBy{Expr: key}
+		if p.acceptKeyword("DESC") {
+			order.Desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		if p.acceptKeyword("NULLS") {
+			switch {
+			case p.acceptKeyword("FIRST"):
+				order.Nulls = "FIRST"
+			case p.acceptKeyword("LAST"):
+				order.Nulls = "LAST"
+			default:
+				return nil, p.unexpected("FIRST or LAST")
+			}
+		}
+		orders = append(orders, order)
+		if !p.acceptSymbol(",") {
+			return orders, nil
+		}
+	}
+}
+
+// rowCount reads the number of rows of LIMIT or OFFSET.
+func (p *parser) rowCount() (int, error) {
+	tok := p.peek()
+	n, err := strconv.Atoi(tok.Text)
+	if tok.Kind != tokNumber || err != nil {
+		return 0, p.unexpected("a row count")
+	}
+	p.next()
+	return n, nil
+}
+
+// selectCore reads a SELECT up to its HAVING clause, after its SELECT
+// keyword.
+func (p *parser) selectCore() (*SelectStmt, error) {
+	stmt := &SelectStmt{Limit: -1}
+	stmt.Distinct = p.acceptKeyword("DISTINCT")
+
+	for {
+		item, err := p.selectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if _, err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if err := p.parseFrom(stmt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := noAggregate(stmt.Where, "WHERE"); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := noAggregate(key, "GROUP BY"); err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, key)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := noWindow(stmt.Having, "HAVING"); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// selectItem reads "*", "table.*" or "expr [[AS] alias]".
+func (p *parser) selectItem() (SelectItem, error) {
+	tok := p.peek()
+	if p.acceptSymbol("*") {
+		return SelectItem{Star: true, Pos: tok.Pos}, nil
+	}
+	if dot, star := p.peekAt(1), p.peekAt(2); tok.Kind == tokIdent &&
+		dot.Kind == tokSymbol && dot.Text == "." && star.Kind == tokSymbol && star.Text == "*" {
+		p.i += 3
+		return SelectItem{Star: true, Table: tok.Text, Pos: tok.Pos}, nil
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	item := SelectItem{Expr: e, Pos: tok.Pos}
+	if p.acceptKeyword("AS") {
+		alias, err := p.ident("an alias")
+		if err != nil {
+			return SelectItem{}, err
+		}
+		item.Alias = alias.Text
+	} else if next := p.peek(); next.Kind == tokIdent && !reserved[next.keyword()] {
+		item.Alias = p.next().Text
+	}
+	return item, nil
+}
+
+func (s *SelectStmt) Exec(d *db.Database) error {
+	if d.Active() == "" {
+		return errors.New("no database selected — use USE <database>")
+	}
+
+	tx, done, err := readTx(d)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	res, _, err := s.run(newQuery(d, tx), nil)
+	if err != nil {
+		return err
+	}
+	printResult(res)
+	return nil
+}
+
+// run computes the result of the query. In a subquery, outer is the scope
+// of the enclosing query, and correlated reports whether the result
+// depends on its rows.
+func (s *SelectStmt) run(q *query, outer *scope) (res *result, correlated bool, err error) {
+	if res, correlated, err = s.runCore(q, outer); err != nil || len(s.Compound) == 0 {
+		return res, correlated, err
+	}
+	otherCorrelated, err := combineWith(res, s.Compound, q, outer)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.sortResult(res); err != nil {
+		return nil, false, err
+	}
+	return res, correlated || otherCorrelated, nil
+}
+
+// runCore computes the result of the SELECT without those it is combined
+// with; ORDER BY, LIMIT and OFFSET only apply when there are none.
+func (s *SelectStmt) runCore(q *query, outer *scope) (res *result, correlated bool, err error) {
+	sc := &scope{q: q, outer: outer, correlated: new(bool)}
+	sources, err := s.openSources(sc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	joined, err := s.joinRows(sources, sc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if s.Where != nil {
+		if err := checkColumns(s.Where, sc); err != nil {
+			return nil, false, err
+		}
+	}
+	var rows [][]db.Row
+	for _, tuple := range joined {
+		sc.bind(tuple...)
+		ok, err := matches(s.Where, sc)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			rows = append(rows, tuple)
+		}
+	}
+
+	scopes, err := s.scopes(sc, rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if s.Having != nil {
+		var kept []*scope
+		for _, sc := range scopes {
+			ok, err := matches(s.Having, sc)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				kept = append(kept, sc)
+			}
+		}
+		scopes = kept
+	}
+
+	if calls := windowCalls(s.exprs()); len(calls) > 0 {
+		if err := computeWindows(calls, scopes); err != nil {
+			return nil, false, err
+		}
+	}
+
+	exprs, cols, err := expandItems(s.Items, sc)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.Distinct {
+		if scopes, err = distinctScopes(exprs, scopes); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if len(s.OrderBy) > 0 && len(s.Compound) == 0 {
+		keys := make([][]db.Value, len(scopes))
+		for _, order := range s.OrderBy {
+			key, err := s.orderKey(order, exprs, sc)
+			if err != nil {
+				return nil, false, err
+			}
+			for i, sc := range scopes {
+				v, err := evalValue(key, sc)
+				if err != nil {
+					return nil, false, err
+				}
+				keys[i] = append(keys[i], v)
+			}
+		}
+		sortByKeys(scopes, keys, s.OrderBy)
+	}
+	if len(s.Compound) == 0 {
+		scopes = page(scopes, s.Limit, s.Offset)
+	}
+
+	if res, err = project(exprs, cols, scopes); err != nil {
+		return nil, false, err
+	}
+	return res, *sc.correlated, nil
+}
+
+// orderKey returns the expression an ORDER BY key sorts by: that of the
+// column of the SELECT list it names by alias or position, or itself.
+// exprs are those of the columns of the SELECT list, evaluated against sc.
+// With DISTINCT, the key must be one of them: other values may differ
+// among the rows found equal.
+func (s *SelectStmt) orderKey(order OrderBy, exprs []Expr, sc *scope) (Expr, error) {
+	key := order.Expr
+	if lit, ok := position(key); ok {
+		n, err := columnPosition(lit, len(exprs))
+		if err != nil {
+			return nil, err
+		}
+		return exprs[n], nil
+	}
+	if e, ok := s.aliased(key); ok {
+		return e, nil
+	}
+
+	if s.Distinct && !slices.ContainsFunc(exprs, func(e Expr) bool { return sameExpr(e, key, sc) }) {
+		return nil, fmt.Errorf("%s: with SELECT DISTINCT, ORDER BY must use columns of the SELECT list", key.Position())
+	}
+	return key, nil
+}
+
+// position returns the number an ORDER BY key is when it is one: it then
+// names a column by its position.
+func position(key Expr) (*Literal, bool) {
+	lit, ok := key.(*Literal)
+	return lit, ok && lit.Kind == LitNumber
+}
+
+// columnPosition returns the index of the column of n an ORDER BY position
+// names.
+func columnPosition(lit *Literal, n int) (int, error) {
+	i, err := strconv.Atoi(lit.Value)
+	if err != nil || i < 1 || i > n {
+		return 0, fmt.Errorf("%s: ORDER BY position %s is not that of a column (1 to %d)", lit.Pos, lit.Value, n)
+	}
+	return i - 1, nil
+}
+
+// aliased returns the expression of the item of the SELECT list an ORDER
+// BY key names by its alias.
+func (s *SelectStmt) aliased(key Expr) (Expr, bool) {
+	if ref, ok := key.(*ColumnRef); ok && ref.Table == "" {
+		for _, item := range s.Items {
+			if item.Alias == ref.Name {
+				return item.Expr, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// distinctScopes returns the scopes in which exprs have values that they
+// have in no scope before.
+func distinctScopes(exprs []Expr, scopes []*scope) ([]*scope, error) {
+	var kept []*scope
+	seen := make(map[string]bool)
+	for _, sc := range scopes {
+		values, err := evalAll(exprs, sc)
+		if err != nil {
+			return nil, err
+		}
+		if key := rowKey(values); !seen[key] {
+			seen[key] = true
+			kept = append(kept, sc)
+		}
+	}
+	return kept, nil
+}
+
+// exprs returns the expressions evaluated once the rows are filtered: the
+// SELECT list, HAVING and the ORDER BY key, unless it sorts a combined
+// result.
+func (s *SelectStmt) exprs() []Expr {
+	var exprs []Expr
+	for _, item := range s.Items {
+		if !item.Star {
+			exprs = append(exprs, item.Expr)
+		}
+	}
+	if s.Having != nil {
+		exprs = append(exprs, s.Having)
+	}
+	if len(s.Compound) == 0 {
+		for _, order := range s.OrderBy {
+			// Keys naming an item of the SELECT list are already there
+			if _, ok := s.aliased(order.Expr); ok {
+				continue
+			}
+			if _, ok := position(order.Expr); ok {
+				continue
+			}
+			exprs = append(exprs, order.Expr)
+		}
+	}
+	return exprs
+}
+
+// scopes returns what the SELECT list is evaluated against: each joined
+// row, or each group of them when the query groups or uses aggregate
+// functions. sc holds the tables of the FROM clause.
+func (s *SelectStmt) scopes(sc *scope, rows [][]db.Row) ([]*scope, error) {
+	// Unknown columns are reported even when no row matches
+	exprs := append(s.exprs(), s.GroupBy...)
+	for _, e := range exprs {
+		if err := checkColumns(e, sc); err != nil {
+			return nil, err
+		}
+	}
+
+	calls := aggregateCalls(s.exprs())
+	if len(calls) == 0 && len(s.GroupBy) == 0 {
+		scopes := make([]*scope, len(rows))
+		for i, row := range rows {
+			scopes[i] = sc.with(row)
+		}
+		return scopes, nil
+	}
+
+	for _, item := range s.Items {
+		if item.Star {
+			return nil, fmt.Errorf("%s: * cannot be used with GROUP BY or aggregate functions", item.Pos)
+		}
+	}
+	for _, e := range s.exprs() {
+		if err := checkGrouped(e, s.GroupBy, sc); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := groupRows(s.GroupBy, sc, rows)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]*scope, len(groups))
+	for i, group := range groups {
+		aggs, err := computeAggregates(calls, sc, group)
+		if err != nil {
+			return nil, err
+		}
+		// Grouped columns have the same value in every row of the group
+		first := make([]db.Row, len(sc.tables))
+		if len(group) > 0 {
+			first = group[0]
+		}
+		scopes[i] = sc.with(first)
+		scopes[i].aggs = aggs
+	}
+	return scopes, nil
+}
+
+// checkGrouped reports a column used by e outside an aggregate function
+// and outside the expressions of GROUP BY: its value would differ among
+// the rows of a group.
+func checkGrouped(e Expr, groupBy []Expr, sc *scope) error {
+	if slices.ContainsFunc(groupBy, func(key Expr) bool { return sameExpr(key, e, sc) }) {
+		return nil
+	}
+	switch e := e.(type) {
+	case *AggregateCall:
+		if e.Over == nil {
+			return nil
+		}
+	case *ColumnRef:
+		return fmt.Errorf("%s: column '%s' must appear in GROUP BY or be used in an aggregate function", e.Pos, exprText(e))
+	}
+	for _, sub := range children(e) {
+		if err := checkGrouped(sub, groupBy, sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameExpr reports whether a and b compute the same value: they read the
+// same way, or name the same column, qualified or not.
+func sameExpr(a, b Expr, sc *scope) bool {
+	if exprText(a) == exprText(b) {
+		return true
+	}
+	refA, okA := a.(*ColumnRef)
+	refB, okB := b.(*ColumnRef)
+	if !okA || !okB || refA.Name != refB.Name {
+		return false
+	}
+	tsA, _, errA := sc.column(refA)
+	tsB, _, errB := sc.column(refB)
+	return errA == nil && errB == nil && tsA == tsB
+}
+
+// result is the outcome of a query: column names and rows of values.
+type result struct {
+	cols []string
+	rows [][]db.Value
+}
+
+// expandItems returns the expression and the name of each column of the
+// SELECT list: "*" stands for every column of the tables of sc, and "t.*"
+// for every column of table t.
+func expandItems(items []SelectItem, sc *scope) (exprs []Expr, cols []string, err error) {
+	for _, item := range items {
+		if !item.Star {
+			exprs = append(exprs, item.Expr)
+			cols = append(cols, item.Name())
+			continue
+		}
+		found := false
+		for _, ts := range sc.tables {
+			if item.Table != "" && ts.name != item.Table {
+				continue
+			}
+			found = true
+			for _, c := range ts.cols {
+				exprs = append(exprs, &ColumnRef{Table: ts.name, Name: c.Name, Pos: item.Pos})
+				cols = append(cols, c.Name)
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("%s: unknown table '%s'", item.Pos, item.Table)
+		}
+	}
+	return exprs, cols, nil
+}
+
+// project evaluates exprs, the columns named cols, in each scope.
+func project(exprs []Expr, cols []string, scopes []*scope) (*result, error) {
+	res := &result{cols: cols}
+	for _, sc := range scopes {
+		values, err := evalAll(exprs, sc)
+		if err != nil {
+			return nil, err
+		}
+		res.rows = append(res.rows, values)
+	}
+	return res, nil
+}
+
+// evalAll returns the values of exprs in scope sc.
+func evalAll(exprs []Expr, sc *scope) ([]db.Value, error) {
+	values := make([]db.Value, len(exprs))
+	for i, e := range exprs {
+		v, err := evalValue(e, sc)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// text writes the query back as SQL.
+func (s *SelectStmt) text() string {
+	items := make([]string, len(s.Items))
+	for i, item := range s.Items {
+		switch {
+		case item.Star && item.Table != "":
+			items[i] = item.Table + ".*"
+		case item.Star:
+			items[i] = "*"
+		case item.Alias != "":
+			items[i] = exprText(item.Expr) + " AS " + item.Alias
+		default:
+			items[i] = exprText(item.Expr)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if s.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+	b.WriteString(strings.Join(items, ", ") + " FROM " + s.From.text())
+	for _, j := range s.Joins {
+		switch j.Kind {
+		case "CROSS":
+			b.WriteString(" CROSS JOIN " + j.Source.text())
+		case "LEFT":
+			b.WriteString(" LEFT JOIN " + j.Source.text() + " ON " + exprText(j.On))
+		default:
+			b.WriteString(" JOIN " + j.Source.text() + " ON " + exprText(j.On))
+		}
+	}
+	if s.Where != nil {
+		b.WriteString(" WHERE " + exprText(s.Where))
+	}
+	if len(s.GroupBy) > 0 {
+		keys := make([]string, len(s.GroupBy))
+		for i, key := range s.GroupBy {
+			keys[i] = exprText(key)
+		}
+		b.WriteString(" GROUP BY " + strings.Join(keys, ", "))
+	}
+	if s.Having != nil {
+		b.WriteString(" HAVING " + exprText(s.Having))
+	}
+	for _, c := range s.Compound {
+		b.WriteString(" " + c.Op + " " + c.Select.text())
+	}
+	if len(s.OrderBy) > 0 {
+		b.WriteString(" ORDER BY " + orderByText(s.OrderBy))
+	}
+	if s.Limit >= 0 {
+		b.WriteString(" LIMIT " + strconv.Itoa(s.Limit))
+	}
+	if s.Offset > 0 {
+		b.WriteString(" OFFSET " + strconv.Itoa(s.Offset))
+	}
+	return b.String()
+}
+
+// orderByText writes the keys of an ORDER BY clause back as SQL.
+func orderByText(orders []OrderBy) string {
+	keys := make([]string, len(orders))
+	for i, order := range orders {
+		keys[i] = exprText(order.Expr)
+		if order.Desc {
+			keys[i] += " DESC"
+		}
+		if order.Nulls != "" {
+			keys[i] += " NULLS " + order.Nulls
+		}
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,24 @@
+package sql
+
+import "testing"
+
+func TestDistinctOrderAndOffset(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	exec(t, d, "INSERT INTO users (id, name, city, age) VALUES (5, 'eve', 'Lyon', 25)")
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT DISTINCT city FROM users ORDER BY city", want: []string{"NULL", "Lyon", "Paris"}},
+		{query: "SELECT DISTINCT city, age FROM users WHERE city = 'Lyon'", want: []string{"Lyon|25"}},
+		{query: "SELECT COUNT(DISTINCT city) FROM users", want: []string{"2"}},
+		{query: "SELECT name FROM users ORDER BY city DESC, age ASC", want: []string{"cat", "ann", "bob", "eve", "dan"}},
+		{query: "SELECT name FROM users ORDER BY age NULLS FIRST, id DESC", want: []string{"cat", "eve", "bob", "ann", "dan"}},
+		{query: "SELECT name FROM users ORDER BY age DESC NULLS LAST", want: []string{"dan", "ann", "bob", "eve", "cat"}},
+		{query: "SELECT name, age FROM users WHERE age IS NOT NULL ORDER BY 2, 1 DESC", want: []string{"eve|25", "bob|25", "ann|30", "dan|41"}},
+		{query: "SELECT name AS n FROM users ORDER BY n DESC LIMIT 2", want: []string{"eve", "dan"}},
+		{query: "SELECT name FROM users WHERE city IS NOT NULL ORDER BY city || name DESC", want: []string{"cat", "ann", "eve", "bob"}},
+		{query: "SELECT name FROM users ORDER BY -id LIMIT 2 OFFSET 1", want: []string{"dan", "cat"}},
+		{query: "SELECT id FROM users ORDER BY id LIMIT 10 OFFSET 4", want: []string{"5"}},
+		{query: "SELECT id FROM users ORDER BY id LIMIT 2 OFFSET 9", want: nil},
+		{query: "SELECT id FROM users ORDER BY id LIMIT 0", want: nil},
+		{query: "SELECT name FROM users ORDER BY 3", err: "3"},
+	})
+}
@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// openTestDB opens an empty database in a temporary directory and runs
+// the statements given.
+func openTestDB(t *testing.T, stmts ...string) *db.Database {
+	t.Helper()
+	d, err := db.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	exec(t, d, "CREATE DATABASE test", "USE test")
+	exec(t, d, stmts...)
+	return d
+}
+
+// run parses and executes one statement.
+func run(d *db.Database, query string) error {
+	stmt, err := Parse(query)
+	if err != nil {
+		return err
+	}
+	return stmt.Exec(d)
+}
+
+// exec runs statements that must succeed.
+func exec(t *testing.T, d *db.Database, stmts ...string) {
+	t.Helper()
+	for _, query := range stmts {
+		if err := run(d, query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+}
+
+// selectRows runs a SELECT and returns its rows as they are displayed,
+// with the columns of each row separated by "|".
+func selectRows(d *db.Database, query string) ([]string, error) {
+	stmt, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := stmt.(*SelectStmt)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a SELECT", query)
+	}
+	tx, done, err := readTx(d)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	res, _, err := s.run(newQuery(d, tx), nil)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]string, len(res.rows))
+	for i, row := range res.rows {
+		cells := make([]string, len(row))
+		for j, v := range row {
+			cells[j] = displayValue(v)
+		}
+		rows[i] = strings.Join(cells, "|")
+	}
+	return rows, nil
+}
+
+// queryTest is a SELECT and the rows it returns, or the text of the
+// error it fails with.
+type queryTest struct {
+	query string
+	want  []string
+	err   string
+}
+
+// checkQueries runs each query against d.
+func checkQueries(t *testing.T, d *db.Database, tests []queryTest) {
+	t.Helper()
+	for _, tt := range tests {
+		got, err := selectRows(d, tt.query)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.query, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.query, err)
+		case strings.Join(got, "\n") != strings.Join(tt.want, "\n"):
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
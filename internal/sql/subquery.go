@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// query is one execution of a statement: the transaction its tables are
+// read from, and the results of the subqueries and CTEs that do not depend
+// on the row of an enclosing query, which are computed once. working holds
+// the rows of the recursive CTEs being computed.
+type query struct {
+	d       *db.Database
+	tx      *db.Tx
+	results map[*SelectStmt]*result
+	working map[*CTE]*result
+}
+
+func newQuery(d *db.Database, tx *db.Tx) *query {
+	return &query{d: d, tx: tx, results: make(map[*SelectStmt]*result), working: make(map[*CTE]*result)}
+}
+
+// subquery returns the result of s run inside the scope outer, which is
+// nil for a derived table of the outermost query. correlated reports
+// whether the result depends on the rows of outer.
+func (q *query) subquery(s *SelectStmt, outer *scope) (res *result, correlated bool, err error) {
+	if res, ok := q.results[s]; ok {
+		return res, false, nil
+	}
+	if res, correlated, err = s.run(q, outer); err != nil {
+		return nil, false, err
+	}
+	if !correlated {
+		q.results[s] = res
+	}
+	return res, correlated, nil
+}
+
+// atSubquery reports whether the next tokens start "(SELECT".
+func (p *parser) atSubquery() bool {
+	return p.isSymbol("(") && p.toks[p.i+1].keyword() == "SELECT"
+}
+
+// subquery reads "(SELECT ...)".
+func (p *parser) subquery() (*SelectStmt, error) {
+	if _, err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	s, err := p.selectStmt()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// subqueryResult runs the subquery s of an expression at pos.
+func subqueryResult(s *SelectStmt, pos Pos, sc *scope) (*result, error) {
+	if sc == nil || sc.q == nil {
+		return nil, fmt.Errorf("%s: a subquery cannot be used here", pos)
+	}
+	res, _, err := sc.q.subquery(s, sc)
+	return res, err
+}
+
+// columnResult runs the subquery of e, which must return one column.
+func columnResult(e *SubqueryExpr, sc *scope) (*result, error) {
+	res, err := subqueryResult(e.Query, e.Pos, sc)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.cols) != 1 {
+		return nil, fmt.Errorf("%s: subquery returns %d columns, expected 1", e.Pos, len(res.cols))
+	}
+	return res, nil
+}
+
+// evalScalarSubquery returns the value of the single row of a subquery,
+// or NULL when it has none.
+func evalScalarSubquery(e *SubqueryExpr, sc *scope) (db.Value, error) {
+	res, err := columnResult(e, sc)
+	switch {
+	case err != nil:
+		return db.Value{}, err
+	case len(res.rows) > 1:
+		return db.Value{}, fmt.Errorf("%s: subquery returns more than one row", e.Pos)
+	case len(res.rows) == 0:
+		return db.Null(), nil
+	}
+	return res.rows[0][0], nil
+}
+
+// evalInSubquery evaluates "x [NOT] IN (SELECT ...)" as x compared with
+// each value of the subquery, like a list of values.
+func evalInSubquery(e *InExpr, sc *scope) (truth, error) {
+	x, err := evalValue(e.Expr, sc)
+	if err != nil {
+		return truthFalse, err
+	}
+	res, err := columnResult(e.Query, sc)
+	if err != nil {
+		return truthFalse, err
+	}
+
+	result := truthFalse
+	for _, row := range res.rows {
+		cmp, ok, err := compareValues(x, row[0], e.Expr, e.Query, sc)
+		if err != nil {
+			return truthFalse, err
+		}
+		if !ok {
+			result = truthUnknown
+		} else if cmp == 0 {
+			result = truthTrue
+			break
+		}
+	}
+	if e.Not {
+		return result.not(), nil
+	}
+	return result, nil
+}
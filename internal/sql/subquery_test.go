@@ -0,0 +1,24 @@
+package sql
+
+import "testing"
+
+func TestSubqueries(t *testing.T) {
+	d := openTestDB(t, append(usersSchema, ordersSchema...)...)
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)", want: []string{"ann", "bob"}},
+		{query: "SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)", want: []string{"cat", "dan"}},
+		{query: "SELECT name FROM users u WHERE EXISTS (SELECT id FROM orders o WHERE o.user_id = u.id AND o.amount > 6)", want: []string{"ann"}},
+		{query: "SELECT name FROM users u WHERE NOT EXISTS (SELECT id FROM orders WHERE user_id = u.id)", want: []string{"cat", "dan"}},
+		{query: "SELECT name, (SELECT SUM(amount) FROM orders WHERE user_id = users.id) FROM users WHERE id < 4", want: []string{"ann|12", "bob|3", "cat|NULL"}},
+		{query: "SELECT name FROM users WHERE age > (SELECT AVG(age) FROM users)", want: []string{"dan"}},
+		{query: "SELECT t.city, t.n FROM (SELECT city, COUNT(*) AS n FROM users GROUP BY city) AS t WHERE t.n > 1", want: []string{"Paris|2"}},
+		{query: "SELECT total FROM (SELECT user_id, SUM(amount) AS total FROM orders GROUP BY user_id) t ORDER BY total DESC LIMIT 1", want: []string{"12"}},
+		{query: "SELECT name FROM users WHERE id = (SELECT user_id FROM orders)", err: "more than one row"},
+		{query: "SELECT name FROM users WHERE id IN (SELECT id, name FROM users)", err: "column"},
+	})
+
+	exec(t, d, "DELETE FROM orders WHERE user_id NOT IN (SELECT id FROM users)")
+	checkQueries(t, d, []queryTest{
+		{query: "SELECT id FROM orders", want: []string{"10", "11", "12"}},
+	})
+}
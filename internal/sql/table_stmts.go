@@ -3,7 +3,7 @@ package sql
 import (
 	"errors"
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/abmcmanu/go-mini-sqlite/internal/db"
@@ -12,14 +12,6 @@ import (
 
 type ShowTablesStmt struct{}
 
-func parseShowTables(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)SHOW\s+TABLES;?`)
-	if !re.MatchString(query) {
-		return nil, errors.New("invalid SHOW TABLES syntax")
-	}
-	return &ShowTablesStmt{}, nil
-}
-
 func (s *ShowTablesStmt) Exec(d *db.Database) error {
 	tables, err := d.ListTables()
 	if err != nil {
@@ -39,24 +31,23 @@ func (s *ShowTablesStmt) Exec(d *db.Database) error {
 }
 
 type DescribeStmt struct {
-	Table string
+	Table TableRef
 }
 
-func parseDescribe(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)(?:DESCRIBE|DESC)\s+([a-zA-Z0-9_]+);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid DESCRIBE syntax")
+func (p *parser) parseDescribe() (Statement, error) {
+	table, err := p.tableRef()
+	if err != nil {
+		return nil, err
 	}
-	return &DescribeStmt{Table: m[1]}, nil
+	return &DescribeStmt{Table: table}, nil
 }
 
 func (s *DescribeStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
+	if d.Active() == "" {
 		return errors.New("no database selected — use USE <database>")
 	}
 
-	t, err := d.GetTable(s.Table)
+	t, err := d.GetTable(s.Table.Name)
 	if err != nil {
 		return err
 	}
@@ -65,7 +56,7 @@ func (s *DescribeStmt) Exec(d *db.Database) error {
 	for _, col := range t.Schema.Columns {
 		row := map[string]string{
 			"Field": col.Name,
-			"Type":  string(col.Type),
+			"Type":  col.TypeName(),
 			"Key":   "",
 			"Null":  "YES",
 			"Extra": "",
@@ -100,42 +91,117 @@ type CreateTableStmt struct {
 	Columns []db.Column
 }
 
-func parseCreateTable(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)CREATE\s+TABLE\s+([a-zA-Z0-9_]+)\s*\((.+)\);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 3 {
-		return nil, errors.New("invalid CREATE TABLE syntax")
+func (p *parser) parseCreateTable() (Statement, error) {
+	name, err := p.ident("a table name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectSymbol("("); err != nil {
+		return nil, err
 	}
 
-	name := m[1]
-	colDefs := strings.Split(m[2], ",")
 	var cols []db.Column
-	for _, def := range colDefs {
-		def = strings.TrimSpace(def)
-		parts := strings.Fields(def)
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("invalid column: %s", def)
+	seen := make(map[string]bool)
+	for {
+		colName, err := p.ident("a column name")
+		if err != nil {
+			return nil, err
+		}
+		if seen[colName.Text] {
+			return nil, syntaxError(colName.Pos, fmt.Sprintf("duplicate column '%s'", colName.Text))
 		}
+		seen[colName.Text] = true
 
-		col := db.Column{Name: parts[0], Type: db.ColType(strings.ToUpper(parts[1]))}
-		defUpper := strings.ToUpper(def)
+		col := db.Column{Name: colName.Text}
+		if err := p.columnType(&col); err != nil {
+			return nil, err
+		}
 
-		if strings.Contains(defUpper, "PRIMARY KEY") {
-			col.PrimaryKey = true
+		// Column constraints, in any order
+		for done := false; !done; {
+			switch {
+			case p.acceptKeyword("PRIMARY"):
+				if _, err := p.expectKeyword("KEY"); err != nil {
+					return nil, err
+				}
+				col.PrimaryKey = true
+			case p.acceptKeyword("NOT"):
+				if _, err := p.expectKeyword("NULL"); err != nil {
+					return nil, err
+				}
+				col.NotNull = true
+			case p.acceptKeyword("UNIQUE"):
+				col.Unique = true
+			default:
+				done = true
+			}
 		}
-		if strings.Contains(defUpper, "NOT NULL") {
-			col.NotNull = true
+		cols = append(cols, col)
+
+		if p.acceptSymbol(")") {
+			break
 		}
-		if strings.Contains(defUpper, "UNIQUE") {
-			col.Unique = true
+		if !p.acceptSymbol(",") {
+			return nil, p.unexpected(`PRIMARY KEY, NOT NULL, UNIQUE, "," or ")"`)
 		}
-		cols = append(cols, col)
 	}
-	return &CreateTableStmt{Name: name, Columns: cols}, nil
+	return &CreateTableStmt{Name: name.Text, Columns: cols}, nil
+}
+
+// columnType reads the type of a column: a type name, with DOUBLE
+// optionally followed by PRECISION and DECIMAL by "(precision[, scale])".
+func (p *parser) columnType(col *db.Column) error {
+	name, err := p.ident("a column type")
+	if err != nil {
+		return err
+	}
+	if col.Type, err = db.ParseColType(name.Text); err != nil {
+		return syntaxError(name.Pos, err.Error())
+	}
+	if name.keyword() == "DOUBLE" {
+		p.acceptKeyword("PRECISION")
+	}
+	if col.Type != db.TypeDecimal {
+		return nil
+	}
+
+	col.Precision, col.Scale = db.DefaultDecimalPrecision, db.DefaultDecimalScale
+	if !p.acceptSymbol("(") {
+		return nil
+	}
+	if col.Precision, err = p.typeParam("a precision"); err != nil {
+		return err
+	}
+	col.Scale = 0
+	if p.acceptSymbol(",") {
+		if col.Scale, err = p.typeParam("a scale"); err != nil {
+			return err
+		}
+	}
+	if _, err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	if col.Precision < 1 || col.Precision > db.MaxDecimalPrecision {
+		return syntaxError(name.Pos, fmt.Sprintf("DECIMAL precision must be between 1 and %d", db.MaxDecimalPrecision))
+	}
+	if col.Scale > col.Precision {
+		return syntaxError(name.Pos, "DECIMAL scale cannot exceed its precision")
+	}
+	return nil
+}
+
+func (p *parser) typeParam(what string) (int, error) {
+	tok := p.peek()
+	n, err := strconv.Atoi(tok.Text)
+	if tok.Kind != tokNumber || err != nil {
+		return 0, p.unexpected(what)
+	}
+	p.next()
+	return n, nil
 }
 
 func (s *CreateTableStmt) Exec(d *db.Database) error {
-	if d.ActiveDB == "" {
+	if d.Active() == "" {
 		return errors.New("no database selected — use USE <database>")
 	}
 	return d.CreateTable(s.Name, db.Schema{Columns: s.Columns})
@@ -145,13 +211,12 @@ type DropTableStmt struct {
 	Name string
 }
 
-func parseDropTable(query string) (Statement, error) {
-	re := regexp.MustCompile(`(?i)DROP\s+TABLE\s+([a-zA-Z0-9_]+);?`)
-	m := re.FindStringSubmatch(query)
-	if len(m) < 2 {
-		return nil, errors.New("invalid DROP TABLE syntax")
+func (p *parser) parseDropTable() (Statement, error) {
+	name, err := p.ident("a table name")
+	if err != nil {
+		return nil, err
 	}
-	return &DropTableStmt{Name: m[1]}, nil
+	return &DropTableStmt{Name: name.Text}, nil
 }
 
 func (s *DropTableStmt) Exec(d *db.Database) error {
@@ -0,0 +1,159 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+type BeginStmt struct{}
+
+func (p *parser) parseBegin() (Statement, error) {
+	p.acceptKeyword("TRANSACTION")
+	return &BeginStmt{}, nil
+}
+
+func (s *BeginStmt) Exec(d *db.Database) error {
+	if err := d.Begin(); err != nil {
+		return err
+	}
+	fmt.Println("Transaction started.")
+	return nil
+}
+
+type CommitStmt struct{}
+
+func (p *parser) parseCommit() (Statement, error) {
+	p.acceptKeyword("TRANSACTION")
+	return &CommitStmt{}, nil
+}
+
+func (s *CommitStmt) Exec(d *db.Database) error {
+	if err := d.Commit(); err != nil {
+		return err
+	}
+	fmt.Println("Transaction committed.")
+	return nil
+}
+
+type RollbackStmt struct {
+	Savepoint string // ROLLBACK TO <savepoint> when set
+}
+
+func (p *parser) parseRollback() (Statement, error) {
+	p.acceptKeyword("TRANSACTION")
+	if !p.acceptKeyword("TO") {
+		return &RollbackStmt{}, nil
+	}
+	p.acceptKeyword("SAVEPOINT")
+	name, err := p.ident("a savepoint name")
+	if err != nil {
+		return nil, err
+	}
+	return &RollbackStmt{Savepoint: name.Text}, nil
+}
+
+func (s *RollbackStmt) Exec(d *db.Database) error {
+	if s.Savepoint != "" {
+		if err := d.RollbackTo(s.Savepoint); err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back to savepoint '%s'.\n", s.Savepoint)
+		return nil
+	}
+
+	if err := d.Rollback(); err != nil {
+		return err
+	}
+	fmt.Println("Transaction rolled back.")
+	return nil
+}
+
+type SavepointStmt struct {
+	Name string
+}
+
+func (p *parser) parseSavepoint() (Statement, error) {
+	name, err := p.ident("a savepoint name")
+	if err != nil {
+		return nil, err
+	}
+	return &SavepointStmt{Name: name.Text}, nil
+}
+
+func (s *SavepointStmt) Exec(d *db.Database) error {
+	if err := d.Savepoint(s.Name); err != nil {
+		return err
+	}
+	fmt.Printf("Savepoint '%s' set.\n", s.Name)
+	return nil
+}
+
+type ReleaseStmt struct {
+	Name string
+}
+
+func (p *parser) parseRelease() (Statement, error) {
+	p.acceptKeyword("SAVEPOINT")
+	name, err := p.ident("a savepoint name")
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseStmt{Name: name.Text}, nil
+}
+
+func (s *ReleaseStmt) Exec(d *db.Database) error {
+	if err := d.Release(s.Name); err != nil {
+		return err
+	}
+	fmt.Printf("Savepoint '%s' released.\n", s.Name)
+	return nil
+}
+
+// withTx runs fn in the transaction opened by BEGIN, or in a transaction
+// of its own committed right after fn when none is open. If fn fails inside
+// an open transaction, the whole transaction is rolled back; when
+// savepoints are set, the transaction is instead aborted until it is
+// rolled back to one of them.
+func withTx(d *db.Database, fn func(tx *db.Tx) error) error {
+	if tx := d.Tx(); tx != nil {
+		if tx.Failed() {
+			return db.ErrTxAborted
+		}
+		if err := fn(tx); err != nil {
+			if tx.HasSavepoints() {
+				tx.Fail()
+				return fmt.Errorf("%v — transaction aborted, use ROLLBACK TO <savepoint> or ROLLBACK", err)
+			}
+			d.Rollback()
+			return fmt.Errorf("%v — transaction rolled back", err)
+		}
+		return nil
+	}
+
+	tx, err := d.NewTx()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// readTx returns the transaction a query reads from: the one opened by
+// BEGIN, or a transaction of its own that done ends. Every table of the
+// query is thus read at the same snapshot.
+func readTx(d *db.Database) (tx *db.Tx, done func(), err error) {
+	if tx := d.Tx(); tx != nil {
+		if tx.Failed() {
+			return nil, nil, db.ErrTxAborted
+		}
+		return tx, func() {}, nil
+	}
+	if tx, err = d.NewTx(); err != nil {
+		return nil, nil, err
+	}
+	return tx, tx.Rollback, nil
+}
@@ -0,0 +1,155 @@
+package sql
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// accountsSchema is shared by the transaction tests.
+var accountsSchema = []string{
+	"CREATE TABLE accounts (id INT PRIMARY KEY, owner TEXT UNIQUE, balance INT)",
+	"CREATE TABLE audit (id INT PRIMARY KEY, note TEXT)",
+	"INSERT INTO accounts (id, owner, balance) VALUES (1, 'ann', 100)",
+}
+
+func TestTransactions(t *testing.T) {
+	tests := []struct {
+		name  string
+		stmts []string
+		err   string // error of the last statement
+		want  []string
+	}{
+		{
+			name: "commit",
+			stmts: []string{
+				"BEGIN",
+				"INSERT INTO accounts (id, owner, balance) VALUES (2, 'bob', 50)",
+				"UPDATE accounts SET balance = balance - 10 WHERE id = 1",
+				"INSERT INTO audit (id, note) VALUES (1, 'moved 10')",
+				"COMMIT",
+			},
+			want: []string{"1|ann|90", "2|bob|50", "audit 1"},
+		},
+		{
+			name: "rollback",
+			stmts: []string{
+				"BEGIN",
+				"INSERT INTO accounts (id, owner, balance) VALUES (2, 'bob', 50)",
+				"DELETE FROM accounts WHERE id = 1",
+				"INSERT INTO audit (id, note) VALUES (1, 'x')",
+				"ROLLBACK",
+			},
+			want: []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name: "error rolls back the transaction",
+			stmts: []string{
+				"BEGIN",
+				"UPDATE accounts SET balance = 0 WHERE id = 1",
+				"INSERT INTO audit (id, note) VALUES (1, 'x')",
+				"INSERT INTO accounts (id, owner, balance) VALUES (2, 'ann', 0)",
+			},
+			err:  "transaction rolled back",
+			want: []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name:  "commit without transaction",
+			stmts: []string{"COMMIT"},
+			err:   "no transaction in progress",
+			want:  []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name:  "rollback without transaction",
+			stmts: []string{"ROLLBACK"},
+			err:   "no transaction in progress",
+			want:  []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name:  "nested begin",
+			stmts: []string{"BEGIN", "BEGIN"},
+			err:   "already in progress",
+			want:  []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name:  "create table inside a transaction",
+			stmts: []string{"BEGIN", "CREATE TABLE t (id INT PRIMARY KEY)"},
+			err:   "inside a transaction",
+			want:  []string{"1|ann|100", "audit 0"},
+		},
+		{
+			name:  "duplicate primary key",
+			stmts: []string{"INSERT INTO accounts (id, owner, balance) VALUES (1, 'bob', 0)"},
+			err:   "duplicate primary key",
+			want:  []string{"1|ann|100", "audit 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := openTestDB(t, accountsSchema...)
+			last := len(tt.stmts) - 1
+			exec(t, d, tt.stmts[:last]...)
+			err := run(d, tt.stmts[last])
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("%s: %v", tt.stmts[last], err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("%s: got error %v, want %q", tt.stmts[last], err, tt.err)
+			}
+			if d.Tx() != nil {
+				exec(t, d, "ROLLBACK")
+			}
+
+			got, err := selectRows(d, "SELECT * FROM accounts ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			audit, err := selectRows(d, "SELECT COUNT(*) FROM audit")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, "audit "+audit[0])
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcurrentUniqueInserts runs autocommit INSERTs of one UNIQUE value
+// from several goroutines: exactly one of them may succeed.
+func TestConcurrentUniqueInserts(t *testing.T) {
+	d := openTestDB(t, accountsSchema...)
+
+	errs := make([]error, 8)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = run(d, "INSERT INTO accounts (owner, balance) VALUES ('zed', 0)")
+		}()
+	}
+	wg.Wait()
+
+	inserted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			inserted++
+		case !strings.Contains(err.Error(), "already exists for UNIQUE column 'owner'") &&
+			!strings.Contains(err.Error(), "could not serialize access"):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if inserted != 1 {
+		t.Fatalf("%d inserts succeeded, want 1", inserted)
+	}
+	got, err := selectRows(d, "SELECT COUNT(*) FROM accounts WHERE owner = 'zed'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != "1" {
+		t.Fatalf("%s rows hold zed, want 1", got[0])
+	}
+}
@@ -0,0 +1,473 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/abmcmanu/go-mini-sqlite/internal/db"
+)
+
+// windowFunctions lists the functions that only exist over a window, with
+// their number of arguments:
+//
+//	ROW_NUMBER()                    position of the row in its partition
+//	RANK()                          position of the first row with the same ORDER BY keys
+//	DENSE_RANK()                    number of distinct ORDER BY keys up to the row
+//	LAG(expr [, offset [, default]]) expr offset rows before (1 by default), or default
+//	LEAD(expr [, offset [, default]]) expr offset rows after
+var windowFunctions = map[string]struct{ minArgs, maxArgs int }{
+	"ROW_NUMBER": {0, 0},
+	"RANK":       {0, 0},
+	"DENSE_RANK": {0, 0},
+	"LAG":        {1, 3},
+	"LEAD":       {1, 3},
+}
+
+// windowCall reads "name(arg, ...) OVER (...)".
+func (p *parser) windowCall() (Expr, error) {
+	name := p.next()
+	p.next() // (
+
+	call := &WindowCall{Name: name.keyword(), Pos: name.Pos}
+	if !p.isSymbol(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	fn := windowFunctions[call.Name]
+	if n := len(call.Args); n < fn.minArgs || n > fn.maxArgs {
+		return nil, syntaxError(name.Pos, fmt.Sprintf("%s takes %s", call.Name, arity(fn.minArgs, fn.maxArgs)))
+	}
+	for _, arg := range call.Args {
+		if err := noWindow(arg, "the argument of "+call.Name); err != nil {
+			return nil, err
+		}
+	}
+	if !p.acceptKeyword("OVER") {
+		return nil, p.unexpected(fmt.Sprintf("OVER after %s()", call.Name))
+	}
+	var err error
+	call.Over, err = p.window()
+	return call, err
+}
+
+// window reads the window after OVER:
+//
+//	"(" [PARTITION BY expr, ...] [ORDER BY key, ...]
+//	    [ROWS BETWEEN bound AND bound | ROWS bound] ")"
+//
+// where a key is read by orderByList and a bound is UNBOUNDED PRECEDING,
+// n PRECEDING, CURRENT ROW, n FOLLOWING or UNBOUNDED FOLLOWING. "ROWS
+// bound" ends at the current row. A frame cannot start after its end.
+func (p *parser) window() (*Window, error) {
+	if _, err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	w := &Window{}
+
+	if p.acceptKeyword("PARTITION") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := noWindow(key, "PARTITION BY"); err != nil {
+				return nil, err
+			}
+			w.PartitionBy = append(w.PartitionBy, key)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		var err error
+		if w.OrderBy, err = p.orderByList(); err != nil {
+			return nil, err
+		}
+		for _, order := range w.OrderBy {
+			if err := noWindow(order.Expr, "the ORDER BY of a window"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.acceptKeyword("ROWS") {
+		between := p.acceptKeyword("BETWEEN")
+		start := p.peek()
+		frame := &Frame{}
+		var err error
+		if frame.Start, err = p.frameBound(); err != nil {
+			return nil, err
+		}
+		end := start
+		if between {
+			if _, err := p.expectKeyword("AND"); err != nil {
+				return nil, err
+			}
+			end = p.peek()
+			if frame.End, err = p.frameBound(); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case frame.Start.Unbounded && frame.Start.Offset > 0:
+			return nil, syntaxError(start.Pos, "a frame cannot start at UNBOUNDED FOLLOWING")
+		case frame.End.Unbounded && frame.End.Offset < 0:
+			return nil, syntaxError(end.Pos, "a frame cannot end at UNBOUNDED PRECEDING")
+		case frame.Start.after(frame.End):
+			return nil, syntaxError(start.Pos, fmt.Sprintf("a frame cannot start at %s, after its end at %s", frame.Start.text(), frame.End.text()))
+		}
+		w.Frame = frame
+	}
+
+	if _, err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// frameBound reads a bound of a frame.
+func (p *parser) frameBound() (FrameBound, error) {
+	if p.acceptKeyword("CURRENT") {
+		_, err := p.expectKeyword("ROW")
+		return FrameBound{}, err
+	}
+
+	bound := FrameBound{Offset: 1}
+	if p.acceptKeyword("UNBOUNDED") {
+		bound.Unbounded = true
+	} else {
+		tok := p.peek()
+		n, err := strconv.Atoi(tok.Text)
+		if tok.Kind != tokNumber || err != nil {
+			return bound, p.unexpected("UNBOUNDED, CURRENT ROW or a number of rows")
+		}
+		p.next()
+		bound.Offset = n
+	}
+	switch {
+	case p.acceptKeyword("PRECEDING"):
+		bound.Offset = -bound.Offset
+	case !p.acceptKeyword("FOLLOWING"):
+		return bound, p.unexpected("PRECEDING or FOLLOWING")
+	}
+	return bound, nil
+}
+
+// exprs returns the expressions of the PARTITION BY and ORDER BY of w,
+// which may be nil.
+func (w *Window) exprs() []Expr {
+	if w == nil {
+		return nil
+	}
+	exprs := append([]Expr(nil), w.PartitionBy...)
+	for _, order := range w.OrderBy {
+		exprs = append(exprs, order.Expr)
+	}
+	return exprs
+}
+
+// text writes " OVER (...)" back as SQL, or nothing when w is nil.
+func (w *Window) text() string {
+	if w == nil {
+		return ""
+	}
+	var parts []string
+	if len(w.PartitionBy) > 0 {
+		keys := make([]string, len(w.PartitionBy))
+		for i, key := range w.PartitionBy {
+			keys[i] = exprText(key)
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(keys, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		parts = append(parts, "ORDER BY "+orderByText(w.OrderBy))
+	}
+	if w.Frame != nil {
+		parts = append(parts, "ROWS BETWEEN "+w.Frame.Start.text()+" AND "+w.Frame.End.text())
+	}
+	return " OVER (" + strings.Join(parts, " ") + ")"
+}
+
+func (b FrameBound) text() string {
+	switch {
+	case b.Unbounded && b.Offset < 0:
+		return "UNBOUNDED PRECEDING"
+	case b.Unbounded:
+		return "UNBOUNDED FOLLOWING"
+	case b.Offset < 0:
+		return strconv.Itoa(-b.Offset) + " PRECEDING"
+	case b.Offset > 0:
+		return strconv.Itoa(b.Offset) + " FOLLOWING"
+	}
+	return "CURRENT ROW"
+}
+
+// noWindow reports a window function used where its value cannot be
+// known yet.
+func noWindow(e Expr, clause string) error {
+	var err error
+	walk(e, func(e Expr) {
+		if err == nil && windowOf(e) != nil {
+			err = syntaxError(e.Position(), fmt.Sprintf("window function %s is not allowed in %s", callName(e), clause))
+		}
+	})
+	return err
+}
+
+// windowOf returns the window of a window function call, or nil when e is
+// not one.
+func windowOf(e Expr) *Window {
+	switch e := e.(type) {
+	case *AggregateCall:
+		return e.Over
+	case *WindowCall:
+		return e.Over
+	}
+	return nil
+}
+
+func callName(e Expr) string {
+	switch e := e.(type) {
+	case *AggregateCall:
+		return e.Name
+	case *WindowCall:
+		return e.Name
+	}
+	return exprText(e)
+}
+
+// windowCalls returns the window function calls made by exprs.
+func windowCalls(exprs []Expr) []Expr {
+	var calls []Expr
+	for _, e := range exprs {
+		walk(e, func(e Expr) {
+			if windowOf(e) != nil {
+				calls = append(calls, e)
+			}
+		})
+	}
+	return calls
+}
+
+// computeWindows sets in each scope the value each window function call
+// has there. Each call sees the scopes of its partition, in order.
+func computeWindows(calls []Expr, scopes []*scope) error {
+	for _, sc := range scopes {
+		sc.windows = make(map[Expr]db.Value, len(calls))
+	}
+	for _, call := range calls {
+		w := windowOf(call)
+		partitions, err := partition(w.PartitionBy, scopes)
+		if err != nil {
+			return err
+		}
+		for _, part := range partitions {
+			keys := make([][]db.Value, len(part))
+			for i, sc := range part {
+				for _, order := range w.OrderBy {
+					v, err := evalValue(order.Expr, sc)
+					if err != nil {
+						return err
+					}
+					keys[i] = append(keys[i], v)
+				}
+			}
+			sortByKeys(part, keys, w.OrderBy)
+
+			var values []db.Value
+			switch call := call.(type) {
+			case *AggregateCall:
+				values, err = windowAggregate(call, w, part, keys)
+			case *WindowCall:
+				values, err = windowFunction(call, w, part, keys)
+			}
+			if err != nil {
+				return err
+			}
+			for i, sc := range part {
+				sc.windows[call] = values[i]
+			}
+		}
+	}
+	return nil
+}
+
+// partition splits scopes into groups having the same values of the keys,
+// in the order their first scope comes.
+func partition(keys []Expr, scopes []*scope) ([][]*scope, error) {
+	var parts [][]*scope
+	index := make(map[string]int)
+	for _, sc := range scopes {
+		values := make([]db.Value, len(keys))
+		for i, key := range keys {
+			v, err := evalValue(key, sc)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		id := rowKey(values)
+		i, ok := index[id]
+		if !ok {
+			i = len(parts)
+			index[id] = i
+			parts = append(parts, nil)
+		}
+		parts[i] = append(parts[i], sc)
+	}
+	return parts, nil
+}
+
+// windowFunction returns the values of a call to a window function for
+// each scope of a partition, sorted by the ORDER BY keys of the window.
+func windowFunction(call *WindowCall, w *Window, part []*scope, keys [][]db.Value) ([]db.Value, error) {
+	values := make([]db.Value, len(part))
+	rank, dense := 0, 0
+	for i, sc := range part {
+		peer := i > 0 && compareKeys(keys[i-1], keys[i], w.OrderBy) == 0
+		if !peer {
+			rank = i + 1
+			dense++
+		}
+
+		switch call.Name {
+		case "ROW_NUMBER":
+			values[i] = db.Int(int64(i + 1))
+		case "RANK":
+			values[i] = db.Int(int64(rank))
+		case "DENSE_RANK":
+			values[i] = db.Int(int64(dense))
+		case "LAG", "LEAD":
+			v, err := lagLead(call, part, i, sc)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+	}
+	return values, nil
+}
+
+// lagLead returns the value of LAG or LEAD for the i-th scope sc of a
+// partition.
+func lagLead(call *WindowCall, part []*scope, i int, sc *scope) (db.Value, error) {
+	offset := int64(1)
+	if len(call.Args) > 1 {
+		v, err := evalValue(call.Args[1], sc)
+		if err != nil {
+			return db.Value{}, err
+		}
+		if v.Kind() != db.KindInt || v.Int() < 0 {
+			return db.Value{}, fmt.Errorf("%s: the offset of %s must be a non-negative integer, not %s", call.Pos, call.Name, v)
+		}
+		offset = v.Int()
+	}
+	if call.Name == "LAG" {
+		offset = -offset
+	}
+
+	if j := int64(i) + offset; j >= 0 && j < int64(len(part)) {
+		return evalValue(call.Args[0], part[j])
+	}
+	if len(call.Args) > 2 {
+		return evalValue(call.Args[2], sc)
+	}
+	return db.Null(), nil
+}
+
+// windowAggregate returns the values of an aggregate function over the
+// frame of each scope of a partition. Without a frame, it spans the rows up
+// to the last with the same ORDER BY keys, or the whole partition when the
+// window has no ORDER BY.
+func windowAggregate(call *AggregateCall, w *Window, part []*scope, keys [][]db.Value) ([]db.Value, error) {
+	args := make([]db.Value, len(part))
+	for i, sc := range part {
+		// COUNT(*) counts rows, whatever their values
+		args[i] = db.Int(1)
+		if !call.Star {
+			v, err := evalValue(call.Args[0], sc)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+	}
+
+	values := make([]db.Value, len(part))
+	for i, sc := range part {
+		start, end := 0, len(part)-1
+		switch {
+		case w.Frame != nil:
+			start, end = w.Frame.Start.row(i, len(part)), w.Frame.End.row(i, len(part))
+		case len(w.OrderBy) > 0:
+			end = i
+			for end+1 < len(part) && compareKeys(keys[end+1], keys[i], w.OrderBy) == 0 {
+				end++
+			}
+		}
+
+		acc, err := newAccumulator(call, sc)
+		if err != nil {
+			return nil, err
+		}
+		for j := max(start, 0); j <= min(end, len(part)-1); j++ {
+			if err := acc.add(args[j]); err != nil {
+				return nil, err
+			}
+		}
+		if values[i], err = acc.result(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// after reports whether b lies after c, from any row.
+func (b FrameBound) after(c FrameBound) bool {
+	return b.order() > c.order()
+}
+
+// order returns the place of b relative to the current row.
+func (b FrameBound) order() int {
+	switch {
+	case b.Unbounded && b.Offset < 0:
+		return math.MinInt
+	case b.Unbounded:
+		return math.MaxInt
+	}
+	return b.Offset
+}
+
+// row returns the index of the row a bound stands for, from the i-th row
+// of a partition of n rows. It may fall outside the partition.
+func (b FrameBound) row(i, n int) int {
+	switch {
+	case b.Unbounded && b.Offset < 0:
+		return 0
+	case b.Unbounded:
+		return n - 1
+	}
+	return i + b.Offset
+}
@@ -0,0 +1,50 @@
+package sql
+
+import "testing"
+
+func TestWindowFunctions(t *testing.T) {
+	d := openTestDB(t, usersSchema...)
+	exec(t, d, "INSERT INTO users (id, name, city, age) VALUES (5, 'eve', 'Lyon', 25)")
+	checkQueries(t, d, []queryTest{
+		{
+			query: "SELECT name, ROW_NUMBER() OVER (ORDER BY age DESC, id) FROM users WHERE age IS NOT NULL",
+			want:  []string{"ann|2", "bob|3", "dan|1", "eve|4"},
+		},
+		{
+			query: "SELECT name, RANK() OVER (ORDER BY age), DENSE_RANK() OVER (ORDER BY age) FROM users WHERE age IS NOT NULL ORDER BY id",
+			want:  []string{"ann|3|2", "bob|1|1", "dan|4|3", "eve|1|1"},
+		},
+		{
+			query: "SELECT name, ROW_NUMBER() OVER (PARTITION BY city ORDER BY id) FROM users WHERE city IS NOT NULL ORDER BY city, id",
+			want:  []string{"bob|1", "eve|2", "ann|1", "cat|2"},
+		},
+		{
+			query: "SELECT id, LAG(id) OVER (ORDER BY id), LEAD(id, 2) OVER (ORDER BY id), LAG(id, 1, 0) OVER (ORDER BY id) FROM users",
+			want:  []string{"1|NULL|3|0", "2|1|4|1", "3|2|5|2", "4|3|NULL|3", "5|4|NULL|4"},
+		},
+		{
+			query: "SELECT id, SUM(id) OVER (ORDER BY id) FROM users",
+			want:  []string{"1|1", "2|3", "3|6", "4|10", "5|15"},
+		},
+		{
+			query: "SELECT id, SUM(id) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM users",
+			want:  []string{"1|1", "2|3", "3|5", "4|7", "5|9"},
+		},
+		{
+			query: "SELECT id, SUM(id) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) FROM users",
+			want:  []string{"1|3", "2|6", "3|9", "4|12", "5|9"},
+		},
+		{
+			query: "SELECT id, COUNT(*) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) FROM users",
+			want:  []string{"1|5", "2|4", "3|3", "4|2", "5|1"},
+		},
+		{
+			query: "SELECT id, AVG(age) OVER (PARTITION BY city) FROM users WHERE city = 'Lyon'",
+			want:  []string{"2|25.0", "5|25.0"},
+		},
+		{
+			query: "SELECT id, COUNT(*) OVER () FROM users WHERE id < 3",
+			want:  []string{"1|2", "2|2"},
+		},
+	})
+}
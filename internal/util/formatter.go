@@ -1,6 +1,7 @@
 package util
 
 import (
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
@@ -9,6 +10,19 @@ import (
 // rows : slice de maps représentant les lignes de la table
 // columns : ordre des colonnes à afficher
 func PrintTable(columns []string, rows []map[string]string) {
+	cells := make([][]string, len(rows))
+	for r, row := range rows {
+		cells[r] = make([]string, len(columns))
+		for i, col := range columns {
+			cells[r][i] = cell(row, col)
+		}
+	}
+	PrintRows(columns, cells)
+}
+
+// PrintRows affiche un tableau dont les lignes donnent les valeurs dans
+// l'ordre des colonnes ; plusieurs colonnes peuvent porter le même nom.
+func PrintRows(columns []string, rows [][]string) {
 	if len(columns) == 0 {
 		fmt.Println("(aucune colonne)")
 		return
@@ -21,8 +35,7 @@ func PrintTable(columns []string, rows []map[string]string) {
 	}
 
 	for _, row := range rows {
-		for i, col := range columns {
-			val := row[col]
+		for i, val := range row {
 			if len(val) > widths[i] {
 				widths[i] = len(val)
 			}
@@ -58,8 +71,7 @@ func PrintTable(columns []string, rows []map[string]string) {
 
 	for _, row := range rows {
 		fmt.Print("|")
-		for i, col := range columns {
-			val := row[col]
+		for i, val := range row {
 			fmt.Printf(" %-*s |", widths[i], val)
 		}
 		fmt.Println()
@@ -67,6 +79,28 @@ func PrintTable(columns []string, rows []map[string]string) {
 	printSeparator()
 }
 
+// cell renvoie la valeur affichée d'une colonne : une colonne absente de
+// la ligne vaut NULL
+func cell(row map[string]string, col string) string {
+	val, ok := row[col]
+	if !ok {
+		return "NULL"
+	}
+	return val
+}
+
+// blobPreview est le nombre d'octets d'un BLOB affichés en hexadécimal
+const blobPreview = 16
+
+// FormatBlob renvoie l'affichage d'un BLOB : X'...' en hexadécimal, tronqué
+// au-delà de blobPreview octets et suivi alors de la taille totale
+func FormatBlob(b []byte) string {
+	if len(b) <= blobPreview {
+		return "X'" + strings.ToUpper(hex.EncodeToString(b)) + "'"
+	}
+	return fmt.Sprintf("X'%s...' (%d bytes)", strings.ToUpper(hex.EncodeToString(b[:blobPreview])), len(b))
+}
+
 // totalWidth calcule la largeur totale d'une ligne pour gestion du cas vide
 func totalWidth(widths []int) int {
 	total := 0